@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
 	"wxchat"
 	logs "wxchat/log"
 )
@@ -10,14 +12,38 @@ var (
 	cmdFlag  = false
 	addFlag  = false
 	delFlag  = false
-	nameList = map[string]bool{}
+	nameList = map[string]bool{} // 以稳定ID为key, 重新登录后仍有效
+	logger   = logs.NewLogger()  // 级别可以通过WXCHAT_LOG_LEVEL设置
 )
 
 func main() {
-	logger := logs.NewLogger()
+	// kill -HUP时从文件重新读取级别配置
+	stop, err := logger.ReloadLevelOnSignal("./loglevel.conf")
+	if err != nil {
+		logger.Error(err.Error())
+	} else {
+		defer stop()
+	}
+
 	wx := wxchat.NewWxChat("./db.json", logger)
+
+	// 稳定ID映射表, 重新登录后联系人的ID不变
+	err = wx.SetIdentityMapping("./identity.json")
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	// 聊天记录存档, 用于search命令
+	archive, err := wxchat.OpenJSONLArchive("./archive.jsonl")
+	if err != nil {
+		logger.Error(err.Error())
+	} else {
+		defer archive.Close()
+		wx.SetArchive(archive)
+	}
+
 	MessageListener(wx)
-	err := wx.Login()
+	err = wx.Login()
 	if err != nil {
 		logger.Error(err.Error())
 	}
@@ -42,7 +68,7 @@ func MessageListener(wx *wxchat.WxChat) {
 				if "over" == eventData.Content {
 					cmdFlag = false
 				}
-			} else if nameList[eventData.SenderUserInfo.UserName] && wxchat.TextMessage == eventData.MessageType {
+			} else if nameList[eventData.SenderStableId] && wxchat.TextMessage == eventData.MessageType {
 				_, _ = wx.SendTextMsg("[自动回复]对方暂时不想理你，等会再说(^_^)", eventData.SenderUserInfo.UserName)
 			}
 		}
@@ -52,7 +78,7 @@ func MessageListener(wx *wxchat.WxChat) {
 func cmd(wx *wxchat.WxChat, msg string) error {
 	var err error = nil
 	if "cmd" == msg {
-		_, err = wx.SendTextMsg("1. 添加自动应答好友\n2. 删除自动应答好友\n3. 已添加的好友", "filehelper")
+		_, err = wx.SendTextMsg("1. 添加自动应答好友\n2. 删除自动应答好友\n3. 已添加的好友\nloglevel [级别配置] 查看或修改日志级别\nsearch 关键词 [from:发送人] [group:群] [since:2006-01-02] [until:2006-01-02] 搜索聊天记录", "filehelper")
 	} else if "over" == msg {
 		_, err = wx.SendTextMsg("操作结束", "filehelper")
 	} else if "1" == msg {
@@ -66,20 +92,33 @@ func cmd(wx *wxchat.WxChat, msg string) error {
 	} else if "3" == msg {
 		var names = "当前添加的好友有\n"
 		if len(nameList) > 0 {
-			for name := range nameList {
-				names = fmt.Sprintf("%s|%s", names, wx.GetRemarkName(name))
+			for stableId := range nameList {
+				contact, _ := wx.Contacts().FindByStableId(stableId)
+				names = fmt.Sprintf("%s|%s", names, contact.RemarkName)
 			}
 		} else {
 			names = "当前未添加任何好友"
 		}
 
 		_, err = wx.SendTextMsg(names, "filehelper")
+	} else if strings.HasPrefix(msg, "loglevel") {
+		spec := strings.TrimSpace(strings.TrimPrefix(msg, "loglevel"))
+		if len(spec) > 0 {
+			err = logger.SetLevelSpec(spec)
+			if err != nil {
+				_, err = wx.SendTextMsg(err.Error(), "filehelper")
+				return err
+			}
+		}
+		_, err = wx.SendTextMsg("当前日志级别: "+logger.LevelSpec(), "filehelper")
+	} else if strings.HasPrefix(msg, "search ") {
+		_, err = wx.SendTextMsg(search(wx, strings.TrimPrefix(msg, "search ")), "filehelper")
 	} else if addFlag {
 		userName, err := wx.SearchContact(msg)
 		if err != nil {
 			_, err = wx.SendTextMsg(err.Error(), "filehelper")
 		} else {
-			nameList[userName] = true
+			nameList[wx.StableId(userName)] = true
 		}
 
 	} else if delFlag {
@@ -87,13 +126,50 @@ func cmd(wx *wxchat.WxChat, msg string) error {
 		if err != nil {
 			_, err = wx.SendTextMsg(err.Error(), "filehelper")
 		} else {
-			delete(nameList, userName)
+			delete(nameList, wx.StableId(userName))
 		}
 	}
 
 	return err
 }
 
+// 搜索聊天记录, 返回回复内容
+func search(wx *wxchat.WxChat, q string) string {
+	query, err := wxchat.ParseSearchQuery(q)
+	if err != nil {
+		return err.Error()
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
+	// 不包括文件传输助手中的命令和结果
+	query.Exclude = append(query.Exclude, "filehelper")
+
+	lines := []string{}
+	for _, hit := range wx.Search(query) {
+		data := hit.Message.Message
+		sender := data.SenderUserInfo.RemarkName
+		if len(sender) == 0 || data.IsSendByMySelf {
+			sender = data.SenderUserInfo.NickName
+		}
+		if data.IsGroupMessage {
+			group := data.FromUserInfo.NickName
+			if strings.HasPrefix(data.ToUserName, "@@") {
+				group = data.ToUserInfo.NickName
+			}
+			sender = group + "/" + sender
+		}
+
+		createTime := time.Unix(hit.Message.CreateTime, 0).Format("2006-01-02 15:04")
+		lines = append(lines, fmt.Sprintf("%s %s: %s", createTime, sender, hit.Highlight))
+	}
+
+	if len(lines) == 0 {
+		return "未找到相关的聊天记录"
+	}
+	return fmt.Sprintf("找到%d条聊天记录\n%s", len(lines), strings.Join(lines, "\n"))
+}
+
 /*
 func MessageListener(wx *wxchat.WxChat)  {
 	wx.SetListener(wxchat.MESSAGE_EVENT, func(event wxchat.Event){
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"wxchat"
+)
+
+// 对比两次导出的通讯录
+// 用法: contactdiff [-format json|csv|vcard] old.json new.json
+func main() {
+	formatName := flag.String("format", "", "导出格式 json|csv|vcard, 默认根据文件扩展名判断")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: contactdiff [-format json|csv|vcard] <old> <new>")
+		os.Exit(2)
+	}
+
+	oldContacts, err := readContacts(flag.Arg(0), *formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	newContacts, err := readContacts(flag.Arg(1), *formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	diff := wxchat.DiffContacts(oldContacts, newContacts)
+
+	for _, contact := range diff.Added {
+		fmt.Printf("+ %s\n", describe(contact))
+	}
+	for _, contact := range diff.Removed {
+		fmt.Printf("- %s\n", describe(contact))
+	}
+	for _, rename := range diff.Renamed {
+		fmt.Printf("~ %s => %s\n", describe(rename.Old), describe(rename.New))
+	}
+	fmt.Printf("added=%d removed=%d renamed=%d\n", len(diff.Added), len(diff.Removed), len(diff.Renamed))
+}
+
+func readContacts(path string, formatName string) ([]wxchat.ExportedContact, error) {
+	if formatName == "" {
+		formatName = path
+	}
+	format, err := wxchat.ParseExportFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return wxchat.ReadContacts(f, format)
+}
+
+func describe(contact wxchat.ExportedContact) string {
+	s := contact.NickName
+	if contact.RemarkName != "" {
+		s = contact.RemarkName + "(" + contact.NickName + ")"
+	}
+	if contact.Alias != "" {
+		s += " [" + contact.Alias + "]"
+	}
+	return s
+}
@@ -0,0 +1,355 @@
+package wxchat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 存档的消息
+type ArchivedMessage struct {
+	ConversationKey string // 会话的稳定ID, 群聊为群的ID(与群名称无关), 私聊为对方的ID
+	SenderStableId  string
+	MsgId           string
+	CreateTime      int64 // 消息的发送时间, 来自服务器; 临时记录为0
+	ArchiveTime     int64 // 存档时间
+	Provisional     bool  `json:",omitempty"` // 通过接口发出、尚未收到同步回显的临时记录
+	Message         MessageEventData
+}
+
+// 用于排序和按时间查询的时间, 临时记录使用存档时间
+func (msg ArchivedMessage) Time() int64 {
+	if msg.CreateTime == 0 {
+		return msg.ArchiveTime
+	}
+	return msg.CreateTime
+}
+
+// 存档查询条件
+type ArchiveQuery struct {
+	ConversationKey string // 为空时查询所有会话
+	Since           int64  // CreateTime >= Since, 0不限
+	Until           int64  // CreateTime < Until, 0不限
+	Desc            bool   // 从最新的开始
+	Cursor          string // 上一页返回的NextCursor, 为空时从头开始
+	Limit           int    // 0时为50
+}
+
+// 一页查询结果, NextCursor为空时没有更多
+type ArchivePage struct {
+	Messages   []ArchivedMessage
+	NextCursor string
+}
+
+// 消息存档, 可以实现为其他数据库
+type ArchiveStore interface {
+	// 同一MsgId重复写入时忽略, 已有的是临时记录时替换为新写入的
+	Append(msg ArchivedMessage) error
+	Query(query ArchiveQuery) (ArchivePage, error)
+	Close() error
+}
+
+const defaultArchiveLimit = 50
+
+var ErrArchiveClosed = errors.New("Archive Closed")
+
+// 设置消息存档, 为nil时不存档; 同时从存档建立搜索索引
+func (wx *WxChat) SetArchive(store ArchiveStore) {
+	var search *searchIndex
+	if store != nil {
+		search = wx.buildSearchIndex(store)
+	}
+
+	wx.storeMn.Lock()
+	defer wx.storeMn.Unlock()
+	wx.archive = store
+	wx.searchIndex = search
+}
+
+// 当前的存档和搜索索引, 未设置存档时都为nil
+func (wx *WxChat) currentArchive() (ArchiveStore, *searchIndex) {
+	wx.storeMn.RLock()
+	defer wx.storeMn.RUnlock()
+	return wx.archive, wx.searchIndex
+}
+
+// 存档一条消息
+func (wx *WxChat) archiveMessage(data MessageEventData) {
+	wx.appendArchive(data, false)
+}
+
+func (wx *WxChat) appendArchive(data MessageEventData, provisional bool) {
+	archive, search := wx.currentArchive()
+	if archive == nil {
+		return
+	}
+
+	// 会话对方
+	conversation := data.FromUserName
+	if data.IsGroupMessage {
+		if strings.HasPrefix(data.ToUserName, "@@") {
+			conversation = data.ToUserName
+		}
+	} else if data.IsSendByMySelf {
+		conversation = data.ToUserName
+	}
+	conversationKey := wx.StableId(conversation)
+	if len(conversationKey) == 0 {
+		conversationKey = conversation
+	}
+
+	// 群成员列表不存档
+	data.FromUserInfo.MemberList = nil
+	data.FromUserInfo.MemberMap = nil
+	data.ToUserInfo.MemberList = nil
+	data.ToUserInfo.MemberMap = nil
+
+	msg := ArchivedMessage{
+		ConversationKey: conversationKey,
+		SenderStableId:  data.SenderStableId,
+		MsgId:           data.MsgId,
+		CreateTime:      data.CreateTime,
+		ArchiveTime:     time.Now().Unix(),
+		Provisional:     provisional,
+		Message:         data,
+	}
+	err := archive.Append(msg)
+	if err != nil {
+		wx.log(moduleMessage).Warnw("Archive Message Failed.", "msgId", data.MsgId, "err", err)
+		return
+	}
+
+	if search != nil {
+		search.add(msg)
+	}
+}
+
+// 存档通过接口发出的消息, 发送接口不返回CreateTime, 先存为临时记录, 收到同步回显后替换
+func (wx *WxChat) archiveSent(messageType MessageType, to string, content string, msgId string, msg map[string]interface{}) {
+	if archive, _ := wx.currentArchive(); archive == nil {
+		return
+	}
+
+	toUserInfo, _ := wx.contacts.Get(to)
+	wx.appendArchive(MessageEventData{
+		MessageType:    messageType,
+		IsGroupMessage: strings.HasPrefix(to, "@@"),
+		IsSendByMySelf: true,
+		MsgId:          msgId,
+		Content:        content,
+		FromUserName:   wx.me.UserName,
+		FromUserInfo:   wx.me,
+		SenderUserInfo: SenderUserInfo{
+			UserName:   wx.me.UserName,
+			NickName:   wx.me.NickName,
+			RemarkName: "mySelf",
+		},
+		SenderStableId: wx.me.StableId,
+		ToUserName:     to,
+		ToUserInfo:     toUserInfo,
+		OriginalMsg:    msg,
+	}, true)
+}
+
+// JSONL文件存档, 每行一条消息; 打开时在内存中建立偏移索引
+type JSONLArchive struct {
+	mn      sync.Mutex
+	file    *os.File
+	size    int64
+	entries []jsonlEntry
+	byConv  map[string][]int
+	msgIds  map[string]int // MsgId到entries中的位置
+}
+
+type jsonlEntry struct {
+	offset      int64
+	length      int
+	createTime  int64
+	provisional bool
+}
+
+// 打开或创建JSONL存档, 末尾不完整的一行会被截掉
+func OpenJSONLArchive(filePath string) (*JSONLArchive, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &JSONLArchive{
+		file:   file,
+		byConv: map[string][]int{},
+		msgIds: map[string]int{},
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		var msg ArchivedMessage
+		if json.Unmarshal(line, &msg) == nil && archive.accept(msg) {
+			archive.index(msg, archive.size, len(line))
+		}
+		archive.size += int64(len(line))
+	}
+
+	err = file.Truncate(archive.size)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// 重复的MsgId只在替换临时记录时返回true
+// 需在持有锁时调用
+func (archive *JSONLArchive) accept(msg ArchivedMessage) bool {
+	if len(msg.MsgId) == 0 {
+		return true
+	}
+	i, found := archive.msgIds[msg.MsgId]
+	return !found || (archive.entries[i].provisional && !msg.Provisional)
+}
+
+// 替换临时记录时保留原来的位置, 文件中旧的一行不再被引用
+// 需在持有锁时调用
+func (archive *JSONLArchive) index(msg ArchivedMessage, offset int64, length int) {
+	entry := jsonlEntry{
+		offset:      offset,
+		length:      length,
+		createTime:  msg.Time(),
+		provisional: msg.Provisional,
+	}
+	if i, found := archive.msgIds[msg.MsgId]; found && len(msg.MsgId) > 0 {
+		archive.entries[i] = entry
+		return
+	}
+
+	archive.entries = append(archive.entries, entry)
+	i := len(archive.entries) - 1
+	archive.byConv[msg.ConversationKey] = append(archive.byConv[msg.ConversationKey], i)
+	if len(msg.MsgId) > 0 {
+		archive.msgIds[msg.MsgId] = i
+	}
+}
+
+func (archive *JSONLArchive) Append(msg ArchivedMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	archive.mn.Lock()
+	defer archive.mn.Unlock()
+
+	if archive.file == nil {
+		return ErrArchiveClosed
+	}
+	if !archive.accept(msg) {
+		return nil
+	}
+
+	_, err = archive.file.WriteAt(line, archive.size)
+	if err != nil {
+		return err
+	}
+	err = archive.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	archive.index(msg, archive.size, len(line))
+	archive.size += int64(len(line))
+	return nil
+}
+
+// 按存档顺序查询, Cursor为下一个要检查的位置
+func (archive *JSONLArchive) Query(query ArchiveQuery) (ArchivePage, error) {
+	archive.mn.Lock()
+	defer archive.mn.Unlock()
+
+	page := ArchivePage{Messages: []ArchivedMessage{}}
+	if archive.file == nil {
+		return page, ErrArchiveClosed
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultArchiveLimit
+	}
+
+	var candidates []int
+	if len(query.ConversationKey) > 0 {
+		candidates = archive.byConv[query.ConversationKey]
+	} else {
+		candidates = make([]int, len(archive.entries))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+
+	pos := 0
+	if len(query.Cursor) > 0 {
+		var err error
+		pos, err = strconv.Atoi(query.Cursor)
+		if err != nil || pos < 0 {
+			return page, errors.New("Invalid Archive Cursor")
+		}
+	}
+
+	for ; pos < len(candidates); pos++ {
+		if len(page.Messages) >= limit {
+			page.NextCursor = strconv.Itoa(pos)
+			break
+		}
+
+		i := candidates[pos]
+		if query.Desc {
+			i = candidates[len(candidates)-1-pos]
+		}
+		entry := archive.entries[i]
+		if (query.Since > 0 && entry.createTime < query.Since) || (query.Until > 0 && entry.createTime >= query.Until) {
+			continue
+		}
+
+		line := make([]byte, entry.length)
+		_, err := archive.file.ReadAt(line, entry.offset)
+		if err != nil {
+			return page, err
+		}
+		var msg ArchivedMessage
+		err = json.Unmarshal(line, &msg)
+		if err != nil {
+			return page, err
+		}
+		page.Messages = append(page.Messages, msg)
+	}
+
+	return page, nil
+}
+
+func (archive *JSONLArchive) Close() error {
+	archive.mn.Lock()
+	defer archive.mn.Unlock()
+
+	if archive.file == nil {
+		return nil
+	}
+	err := archive.file.Close()
+	archive.file = nil
+	return err
+}
@@ -0,0 +1,82 @@
+package wxchat
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	logs "wxchat/log"
+)
+
+func TestJSONLArchiveReplacesProvisional(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	archive, err := OpenJSONLArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := ArchivedMessage{ConversationKey: "k", MsgId: "1", ArchiveTime: 200, Provisional: true}
+	echo := ArchivedMessage{ConversationKey: "k", MsgId: "1", CreateTime: 150, ArchiveTime: 201}
+	for _, msg := range []ArchivedMessage{sent, echo, sent} {
+		if err := archive.Append(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(archive *JSONLArchive) {
+		page, err := archive.Query(ArchiveQuery{ConversationKey: "k", Until: 160})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Messages) != 1 || page.Messages[0].CreateTime != 150 || page.Messages[0].Provisional {
+			t.Fatalf("got %+v, want the echo with CreateTime 150", page.Messages)
+		}
+	}
+	check(archive)
+	archive.Close()
+
+	reopened, err := OpenJSONLArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(reopened)
+}
+
+func TestSetArchiveWhileArchiving(t *testing.T) {
+	dir := t.TempDir()
+	wx := NewWxChat(filepath.Join(dir, "db.json"), logs.NewFanoutLogger())
+	wx.me = Contact{UserName: "@me"}
+
+	// 运行中替换存档和头像缓存, 用-race检查
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			archive, err := OpenJSONLArchive(filepath.Join(dir, "archive.jsonl"+string(rune('a'+i))))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			t.Cleanup(func() { archive.Close() })
+			wx.SetArchive(archive)
+			wx.SetAvatarCache(filepath.Join(dir, "avatars"), time.Hour)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			wx.archiveMessage(MessageEventData{MessageType: TextMessage, MsgId: string(rune('1' + i)), FromUserName: "@a", Content: "你好"})
+			wx.Search(SearchQuery{Text: "你好"})
+			wx.invalidateAvatar("@a")
+		}(i)
+	}
+	wg.Wait()
+
+	archive, search := wx.currentArchive()
+	if archive == nil || search == nil {
+		t.Fatal("archive not set")
+	}
+	if wx.currentAvatars() == nil {
+		t.Fatal("avatar cache not set")
+	}
+}
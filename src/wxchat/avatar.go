@@ -0,0 +1,305 @@
+package wxchat
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"wxchat/utils"
+)
+
+// 头像缓存, 以联系人的稳定ID为key, 文件以内容的sha1命名, 相同头像只保存一份
+type avatarCache struct {
+	mn    sync.Mutex
+	dir   string
+	ttl   time.Duration
+	index map[string]avatarEntry
+}
+
+type avatarEntry struct {
+	Hash      string
+	Url       string // 去掉会话参数后的地址
+	FetchTime int64
+}
+
+const avatarIndexName = "index.json"
+
+// 头像地址中每次登录都会变化的参数, 比较地址时忽略
+var avatarSessionParams = []string{"username", "skey", "chatroomid", "pass_ticket"}
+
+// 设置头像缓存目录和有效期, dir为空时不缓存; 过期和不再使用的文件会被删除
+func (wx *WxChat) SetAvatarCache(dir string, ttl time.Duration) error {
+	cache := &avatarCache{
+		dir:   dir,
+		ttl:   ttl,
+		index: map[string]avatarEntry{},
+	}
+
+	if len(dir) > 0 {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			return err
+		}
+
+		bs, err := ioutil.ReadFile(cache.indexPath())
+		if err == nil {
+			json.Unmarshal(bs, &cache.index)
+		}
+		cache.prune()
+	}
+
+	wx.storeMn.Lock()
+	wx.avatars = cache
+	wx.storeMn.Unlock()
+	return nil
+}
+
+// 当前的头像缓存
+func (wx *WxChat) currentAvatars() *avatarCache {
+	wx.storeMn.RLock()
+	defer wx.storeMn.RUnlock()
+	return wx.avatars
+}
+
+// 获取联系人头像
+func (wx *WxChat) GetAvatar(userName string) ([]byte, error) {
+	headImgUrl := ""
+	if userName == wx.me.UserName {
+		headImgUrl = wx.me.HeadImgUrl
+	} else {
+		contact, found := wx.contacts.Get(userName)
+		if !found {
+			return nil, errors.New("Contact Not Found. [userName]:" + userName)
+		}
+		headImgUrl = contact.HeadImgUrl
+	}
+
+	if len(headImgUrl) == 0 {
+		return nil, errors.New("Avatar Not Found. [userName]:" + userName)
+	}
+
+	return wx.fetchAvatar(wx.avatarKey(userName), headImgUrl)
+}
+
+// 获取群成员头像
+func (wx *WxChat) GetGroupMemberAvatar(groupUserName string, userName string) ([]byte, error) {
+	group, found := wx.contacts.Get(groupUserName)
+	if !found {
+		return nil, errors.New("Group Not Found. [group]:" + groupUserName)
+	}
+
+	iconApi := strings.Replace(wxChatApi["memberIconApi"], "{username}", userName, 1)
+	iconApi = strings.Replace(iconApi, "{chatroomid}", group.EncryChatRoomId, 1)
+	iconApi = strings.Replace(iconApi, "{skey}", wx.baseRequest.Skey, 1)
+
+	key := groupUserName + "|" + userName
+	if member, found := group.MemberMap[userName]; found {
+		key = wx.memberStableId(groupUserName, *member)
+	}
+	return wx.fetchAvatar(key, iconApi)
+}
+
+// 扫码用户的头像, UserAvatar为data uri
+func (data ScanCodeEventData) AvatarImage() ([]byte, error) {
+	return utils.DecodeDataUri(data.UserAvatar)
+}
+
+// 缓存key, 没有稳定ID时使用UserName
+func (wx *WxChat) avatarKey(userName string) string {
+	if stableId := wx.StableId(userName); len(stableId) > 0 {
+		return stableId
+	}
+	return userName
+}
+
+// 优先从缓存读取头像, 缓存过期或地址变化时重新下载
+func (wx *WxChat) fetchAvatar(key string, headImgUrl string) ([]byte, error) {
+	if strings.HasPrefix(headImgUrl, "data:") {
+		return utils.DecodeDataUri(headImgUrl)
+	}
+
+	cache := wx.currentAvatars()
+	cacheUrl := avatarCacheUrl(headImgUrl)
+	if bs, found := cache.get(key, cacheUrl); found {
+		return bs, nil
+	}
+
+	avatarUrl := headImgUrl
+	if strings.HasPrefix(avatarUrl, "/") {
+		avatarUrl = "https://" + wx.host + avatarUrl
+	}
+	avatarUrl = strings.Replace(avatarUrl, "{host}", wx.host, 1)
+
+	bs, status, err := wx.httpClient.getWithStatus(avatarUrl, time.Second*10, &httpHeader{
+		Accept:  "image/webp,image/*,*/*;q=0.8",
+		Host:    wx.host,
+		Referer: "https://" + wx.host + "/?&lang=zh_CN",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("Avatar Fetch Failed. [key]:%s [status]:%d", key, status)
+	}
+	if len(bs) == 0 {
+		return nil, errors.New("Avatar Empty. [key]:" + key)
+	}
+	// 会话失效时返回的是错误页面
+	if !strings.HasPrefix(http.DetectContentType(bs), "image/") {
+		return nil, errors.New("Avatar Not Image. [key]:" + key)
+	}
+
+	err = cache.put(key, cacheUrl, bs)
+	if err != nil {
+		wx.log(moduleContacts).Warnw("Avatar Cache Failed.", "err", err)
+	}
+
+	return bs, nil
+}
+
+// 头像地址变化后删除缓存
+func (wx *WxChat) invalidateAvatar(userName string) {
+	wx.currentAvatars().invalidate(wx.avatarKey(userName))
+}
+
+// 去掉会话参数, 只保留路径和seq等与头像内容有关的参数
+func avatarCacheUrl(headImgUrl string) string {
+	u, err := url.Parse(headImgUrl)
+	if err != nil {
+		return headImgUrl
+	}
+	query := u.Query()
+	for _, param := range avatarSessionParams {
+		query.Del(param)
+	}
+	return u.Path + "?" + query.Encode()
+}
+
+func (cache *avatarCache) indexPath() string {
+	return filepath.Join(cache.dir, avatarIndexName)
+}
+
+func (cache *avatarCache) get(key string, url string) ([]byte, bool) {
+	cache.mn.Lock()
+	defer cache.mn.Unlock()
+
+	if len(cache.dir) == 0 {
+		return nil, false
+	}
+
+	entry, found := cache.index[key]
+	if !found || entry.Url != url || cache.expired(entry) {
+		return nil, false
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(cache.dir, entry.Hash))
+	if err != nil {
+		return nil, false
+	}
+	return bs, true
+}
+
+func (cache *avatarCache) put(key string, url string, bs []byte) error {
+	cache.mn.Lock()
+	defer cache.mn.Unlock()
+
+	if len(cache.dir) == 0 {
+		return nil
+	}
+
+	sum := sha1.Sum(bs)
+	hash := hex.EncodeToString(sum[:])
+	err := ioutil.WriteFile(filepath.Join(cache.dir, hash), bs, 0600)
+	if err != nil {
+		return err
+	}
+
+	old, found := cache.index[key]
+	cache.index[key] = avatarEntry{
+		Hash:      hash,
+		Url:       url,
+		FetchTime: time.Now().Unix(),
+	}
+	if found && old.Hash != hash {
+		cache.removeUnused(old.Hash)
+	}
+	return cache.save()
+}
+
+func (cache *avatarCache) invalidate(key string) {
+	cache.mn.Lock()
+	defer cache.mn.Unlock()
+
+	entry, found := cache.index[key]
+	if !found {
+		return
+	}
+	delete(cache.index, key)
+	if len(cache.dir) > 0 {
+		cache.removeUnused(entry.Hash)
+		cache.save()
+	}
+}
+
+// 需在持有锁时调用
+func (cache *avatarCache) expired(entry avatarEntry) bool {
+	return cache.ttl > 0 && time.Since(time.Unix(entry.FetchTime, 0)) > cache.ttl
+}
+
+// 没有其他联系人使用时删除文件, 需在持有锁时调用
+func (cache *avatarCache) removeUnused(hash string) {
+	for _, entry := range cache.index {
+		if entry.Hash == hash {
+			return
+		}
+	}
+	os.Remove(filepath.Join(cache.dir, hash))
+}
+
+// 删除过期的记录和索引中没有的文件
+func (cache *avatarCache) prune() {
+	cache.mn.Lock()
+	defer cache.mn.Unlock()
+
+	used := map[string]bool{}
+	for key, entry := range cache.index {
+		if cache.expired(entry) {
+			delete(cache.index, key)
+			continue
+		}
+		used[entry.Hash] = true
+	}
+
+	entries, err := os.ReadDir(cache.dir)
+	if err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			// 只删除缓存写入的文件
+			if _, err := hex.DecodeString(name); err != nil || len(name) != sha1.Size*2 {
+				continue
+			}
+			if entry.Type().IsRegular() && !used[name] {
+				os.Remove(filepath.Join(cache.dir, name))
+			}
+		}
+	}
+	cache.save()
+}
+
+// 需在持有锁时调用
+func (cache *avatarCache) save() error {
+	bs, err := json.Marshal(cache.index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cache.indexPath(), bs, 0600)
+}
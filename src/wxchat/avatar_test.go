@@ -0,0 +1,61 @@
+package wxchat
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAvatarCacheUrlIgnoresSession(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{
+			"/cgi-bin/mmwebwx-bin/webwxgeticon?seq=1&username=@abc&skey=@crypt_1",
+			"/cgi-bin/mmwebwx-bin/webwxgeticon?seq=1&username=@def&skey=@crypt_2",
+			true,
+		},
+		{
+			"/cgi-bin/mmwebwx-bin/webwxgeticon?seq=1&username=@abc",
+			"/cgi-bin/mmwebwx-bin/webwxgeticon?seq=2&username=@abc",
+			false,
+		},
+		{
+			"https://wx2.qq.com/cgi-bin/mmwebwx-bin/webwxgeticon?seq=0&username=@a&chatroomid=@b&skey=c",
+			"https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxgeticon?seq=0&username=@x&chatroomid=@y&skey=z",
+			true,
+		},
+	}
+	for _, test := range tests {
+		if same := avatarCacheUrl(test.a) == avatarCacheUrl(test.b); same != test.same {
+			t.Errorf("avatarCacheUrl(%q) == avatarCacheUrl(%q): got %v, want %v", test.a, test.b, same, test.same)
+		}
+	}
+}
+
+func TestAvatarCacheEvictsUnusedFiles(t *testing.T) {
+	dir := t.TempDir()
+	wx := &WxChat{}
+	if err := wx.SetAvatarCache(dir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cache := wx.currentAvatars()
+
+	cache.put("a", "/icon?seq=1", []byte("old"))
+	cache.put("a", "/icon?seq=2", []byte("new"))
+	if bs, found := cache.get("a", "/icon?seq=2"); !found || string(bs) != "new" {
+		t.Fatalf("get = %q, %v", bs, found)
+	}
+	if _, found := cache.get("a", "/icon?seq=1"); found {
+		t.Fatal("old url still cached")
+	}
+
+	cache.invalidate("a")
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.Name() != avatarIndexName {
+			t.Errorf("file %s not removed", entry.Name())
+		}
+	}
+}
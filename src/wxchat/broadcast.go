@@ -0,0 +1,151 @@
+package wxchat
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+)
+
+// 联系人过滤器
+type ContactFilter func(contact Contact) bool
+
+// 按联系人类型过滤
+func FilterByType(contactType ContactType) ContactFilter {
+	return func(contact Contact) bool {
+		return contact.Type == contactType
+	}
+}
+
+// 只发给好友, 不包括群、公众号和自己
+func FilterFriends(self string) ContactFilter {
+	return func(contact Contact) bool {
+		return contact.Type == Friend && contact.UserName != self
+	}
+}
+
+// 按省份过滤
+func FilterByProvince(province string) ContactFilter {
+	return func(contact Contact) bool {
+		return contact.Province == province
+	}
+}
+
+// 按城市过滤
+func FilterByCity(city string) ContactFilter {
+	return func(contact Contact) bool {
+		return contact.City == city
+	}
+}
+
+// 按备注名前缀过滤
+func FilterByRemarkPrefix(prefix string) ContactFilter {
+	return func(contact Contact) bool {
+		return strings.HasPrefix(contact.RemarkName, prefix)
+	}
+}
+
+// 同时满足所有过滤条件
+func FilterAll(filters ...ContactFilter) ContactFilter {
+	return func(contact Contact) bool {
+		for _, filter := range filters {
+			if !filter(contact) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// 单个接收人的群发结果
+type BroadcastResult struct {
+	UserName   string
+	NickName   string
+	RemarkName string
+	Content    string
+	Err        error
+}
+
+// 群发报告
+type BroadcastReport struct {
+	DryRun  bool
+	Success int
+	Failed  int
+	Results []BroadcastResult
+}
+
+// 群发消息, tmpl为text/template模板, 以接收人的Contact渲染; dryRun为true时只列出接收人不发送.
+// filter为nil时只发给好友; ctx取消后还未发送的消息会被撤回, 结果中为ErrSendCanceled
+func (wx *WxChat) Broadcast(ctx context.Context, filter ContactFilter, tmpl string, dryRun bool) (*BroadcastReport, error) {
+	// 未登录时发送协程还未启动, 等待结果会一直阻塞
+	if !dryRun && !wx.sendQueue.isRunning() {
+		return nil, ErrSendQueueNotRunning
+	}
+
+	t, err := template.New("broadcast").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		filter = FilterFriends(wx.me.UserName)
+	}
+
+	recipients := []Contact{}
+	wx.contacts.Range(func(contact Contact) bool {
+		if filter(contact) {
+			recipients = append(recipients, contact)
+		}
+		return true
+	})
+
+	report := &BroadcastReport{
+		DryRun:  dryRun,
+		Results: make([]BroadcastResult, len(recipients)),
+	}
+	tickets := make([]*SendTicket, len(recipients))
+
+	for i, contact := range recipients {
+		result := &report.Results[i]
+		result.UserName = contact.UserName
+		result.NickName = contact.NickName
+		result.RemarkName = contact.RemarkName
+
+		buffer := new(bytes.Buffer)
+		result.Err = t.Execute(buffer, contact)
+		result.Content = buffer.String()
+
+		if result.Err == nil && !dryRun {
+			tickets[i] = wx.QueueTextMsg(result.Content, contact.UserName, PRIORITY_LOW)
+		}
+	}
+
+	for _, ticket := range tickets {
+		if ticket != nil && ticket.Wait(ctx) != nil && ctx.Err() != nil {
+			break
+		}
+	}
+
+	// 已取消时撤回还未发送的消息, 正在发送的等待其完成
+	if ctx.Err() != nil {
+		wx.sendQueue.cancel(tickets)
+	}
+	for i, ticket := range tickets {
+		if ticket != nil {
+			<-ticket.Done()
+			report.Results[i].Err = ticket.err
+		}
+	}
+
+	for _, result := range report.Results {
+		if result.Err != nil {
+			report.Failed++
+		} else {
+			report.Success++
+		}
+	}
+
+	wx.log(moduleMessage).Infow("Broadcast Finished.", "recipients", len(recipients), "success", report.Success, "failed", report.Failed, "dryRun", dryRun)
+
+	return report, nil
+}
@@ -0,0 +1,25 @@
+package wxchat
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	logs "wxchat/log"
+)
+
+func TestBroadcastDefaultsToFriends(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.me = Contact{UserName: "@me", Type: Friend}
+	wx.contacts.Put(&Contact{UserName: "@me", Type: Friend})
+	wx.contacts.Put(&Contact{UserName: "@a", Type: Friend})
+	wx.contacts.Put(&Contact{UserName: "@@g", Type: Group})
+	wx.contacts.Put(&Contact{UserName: "@o", Type: Official})
+
+	report, err := wx.Broadcast(context.Background(), nil, "hi", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 1 || report.Results[0].UserName != "@a" {
+		t.Fatalf("got %+v, want only @a", report.Results)
+	}
+}
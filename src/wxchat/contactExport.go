@@ -0,0 +1,502 @@
+package wxchat
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 通讯录导出格式
+type ExportFormat int
+
+const (
+	_            ExportFormat = iota
+	EXPORT_JSON               // JSON数组
+	EXPORT_CSV                // CSV, 群成员以JSON存放在Members列
+	EXPORT_VCARD              // vCard 3.0
+)
+
+// 导出的联系人
+type ExportedContact struct {
+	UserName   string
+	NickName   string
+	RemarkName string
+	Alias      string
+	Province   string
+	City       string
+	Sex        float64
+	Signature  string
+	Type       ContactType
+	StableId   string           `json:",omitempty"`
+	Members    []ExportedMember `json:",omitempty"`
+}
+
+// 导出的群成员
+type ExportedMember struct {
+	UserName    string
+	NickName    string
+	DisplayName string
+}
+
+var csvHeader = []string{"UserName", "NickName", "RemarkName", "Alias", "Province", "City", "Sex", "Signature", "Type", "Members", "StableId"}
+
+// 根据名称或文件扩展名解析导出格式
+func ParseExportFormat(name string) (ExportFormat, error) {
+	if ext := filepath.Ext(name); len(ext) > 0 {
+		name = ext[1:]
+	}
+	name = strings.ToLower(name)
+
+	switch name {
+	case "json":
+		return EXPORT_JSON, nil
+	case "csv":
+		return EXPORT_CSV, nil
+	case "vcf", "vcard":
+		return EXPORT_VCARD, nil
+	}
+	return 0, errors.New("Unknown Export Format: " + name)
+}
+
+// 导出通讯录, withMembers为true时包含群成员
+func (wx *WxChat) ExportContacts(w io.Writer, format ExportFormat, withMembers bool) error {
+	contacts := []ExportedContact{}
+	wx.contacts.Range(func(contact Contact) bool {
+		contacts = append(contacts, exportContact(contact, withMembers))
+		return true
+	})
+
+	return WriteContacts(w, contacts, format)
+}
+
+func exportContact(contact Contact, withMembers bool) ExportedContact {
+	exported := ExportedContact{
+		UserName:   contact.UserName,
+		NickName:   contact.NickName,
+		RemarkName: contact.RemarkName,
+		Alias:      contact.Alias,
+		Province:   contact.Province,
+		City:       contact.City,
+		Sex:        contact.Sex,
+		Signature:  contact.Signature,
+		Type:       contact.Type,
+		StableId:   contact.StableId,
+	}
+
+	if withMembers {
+		for _, member := range contact.MemberList {
+			exported.Members = append(exported.Members, ExportedMember{
+				UserName:    member.UserName,
+				NickName:    member.NickName,
+				DisplayName: member.DisplayName,
+			})
+		}
+	}
+
+	return exported
+}
+
+// 按格式写出联系人
+func WriteContacts(w io.Writer, contacts []ExportedContact, format ExportFormat) error {
+	switch format {
+	case EXPORT_JSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(contacts)
+	case EXPORT_CSV:
+		return writeContactsCSV(w, contacts)
+	case EXPORT_VCARD:
+		return writeContactsVCard(w, contacts)
+	}
+	return errors.New("Unknown Export Format")
+}
+
+// 读取导出的联系人
+func ReadContacts(r io.Reader, format ExportFormat) ([]ExportedContact, error) {
+	switch format {
+	case EXPORT_JSON:
+		contacts := []ExportedContact{}
+		err := json.NewDecoder(r).Decode(&contacts)
+		return contacts, err
+	case EXPORT_CSV:
+		return readContactsCSV(r)
+	case EXPORT_VCARD:
+		return readContactsVCard(r)
+	}
+	return nil, errors.New("Unknown Export Format")
+}
+
+func writeContactsCSV(w io.Writer, contacts []ExportedContact) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, contact := range contacts {
+		members := ""
+		if len(contact.Members) > 0 {
+			bs, err := json.Marshal(contact.Members)
+			if err != nil {
+				return err
+			}
+			members = string(bs)
+		}
+
+		err = writer.Write([]string{
+			contact.UserName,
+			contact.NickName,
+			contact.RemarkName,
+			contact.Alias,
+			contact.Province,
+			contact.City,
+			strconv.FormatFloat(contact.Sex, 'f', -1, 64),
+			contact.Signature,
+			strconv.Itoa(int(contact.Type)),
+			members,
+			contact.StableId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func readContactsCSV(r io.Reader) ([]ExportedContact, error) {
+	reader := csv.NewReader(r)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := []ExportedContact{}
+	for i, row := range rows {
+		if i == 0 && len(row) > 0 && row[0] == csvHeader[0] {
+			continue
+		}
+		// 旧版本导出的文件没有StableId列
+		if len(row) < len(csvHeader)-1 {
+			return nil, fmt.Errorf("CSV line %d: expect %d columns", i+1, len(csvHeader))
+		}
+
+		sex, _ := strconv.ParseFloat(row[6], 64)
+		contactType, _ := strconv.Atoi(row[8])
+		contact := ExportedContact{
+			UserName:   row[0],
+			NickName:   row[1],
+			RemarkName: row[2],
+			Alias:      row[3],
+			Province:   row[4],
+			City:       row[5],
+			Sex:        sex,
+			Signature:  row[7],
+			Type:       ContactType(contactType),
+		}
+		if len(row[9]) > 0 {
+			err = json.Unmarshal([]byte(row[9]), &contact.Members)
+			if err != nil {
+				return nil, fmt.Errorf("CSV line %d: %s", i+1, err.Error())
+			}
+		}
+		if len(row) > 10 {
+			contact.StableId = row[10]
+		}
+		contacts = append(contacts, contact)
+	}
+
+	return contacts, nil
+}
+
+func writeContactsVCard(w io.Writer, contacts []ExportedContact) error {
+	writer := bufio.NewWriter(w)
+	for _, contact := range contacts {
+		name := contact.RemarkName
+		if len(name) == 0 {
+			name = contact.NickName
+		}
+
+		lines := []string{
+			"BEGIN:VCARD",
+			"VERSION:3.0",
+			"FN:" + vCardEscape(name),
+			"N:" + vCardEscape(name) + ";;;;",
+			"NICKNAME:" + vCardEscape(contact.NickName),
+		}
+		if len(contact.Signature) > 0 {
+			lines = append(lines, "NOTE:"+vCardEscape(contact.Signature))
+		}
+		if len(contact.Province) > 0 || len(contact.City) > 0 {
+			lines = append(lines, "ADR:;;;"+vCardEscape(contact.City)+";"+vCardEscape(contact.Province)+";;")
+		}
+		lines = append(lines,
+			"X-WECHAT-USERNAME:"+vCardEscape(contact.UserName),
+			"X-WECHAT-REMARKNAME:"+vCardEscape(contact.RemarkName),
+			"X-WECHAT-ALIAS:"+vCardEscape(contact.Alias),
+			"X-WECHAT-SEX:"+strconv.FormatFloat(contact.Sex, 'f', -1, 64),
+			"X-WECHAT-TYPE:"+strconv.Itoa(int(contact.Type)),
+		)
+		if len(contact.StableId) > 0 {
+			lines = append(lines, "X-WECHAT-STABLEID:"+vCardEscape(contact.StableId))
+		}
+		for _, member := range contact.Members {
+			lines = append(lines, "X-WECHAT-MEMBER:"+vCardEscape(member.UserName)+";"+vCardEscape(member.NickName)+";"+vCardEscape(member.DisplayName))
+		}
+		lines = append(lines, "END:VCARD")
+
+		for _, line := range lines {
+			_, err := writer.WriteString(vCardFold(line) + "\r\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return writer.Flush()
+}
+
+func readContactsVCard(r io.Reader) ([]ExportedContact, error) {
+	contacts := []ExportedContact{}
+	var contact *ExportedContact
+
+	lines, err := vCardUnfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		index := strings.Index(line, ":")
+		if index == -1 {
+			continue
+		}
+		// 忽略TYPE等参数
+		name := strings.ToUpper(strings.SplitN(line[:index], ";", 2)[0])
+		value := line[index+1:]
+
+		switch name {
+		case "BEGIN":
+			contact = &ExportedContact{}
+			continue
+		case "END":
+			if contact != nil {
+				contacts = append(contacts, *contact)
+			}
+			contact = nil
+			continue
+		}
+
+		if contact == nil {
+			continue
+		}
+
+		switch name {
+		case "NICKNAME":
+			contact.NickName = vCardUnescape(value)
+		case "NOTE":
+			contact.Signature = vCardUnescape(value)
+		case "ADR":
+			parts := vCardSplit(value)
+			if len(parts) > 4 {
+				contact.City = parts[3]
+				contact.Province = parts[4]
+			}
+		case "X-WECHAT-USERNAME":
+			contact.UserName = vCardUnescape(value)
+		case "X-WECHAT-REMARKNAME":
+			contact.RemarkName = vCardUnescape(value)
+		case "X-WECHAT-ALIAS":
+			contact.Alias = vCardUnescape(value)
+		case "X-WECHAT-SEX":
+			contact.Sex, _ = strconv.ParseFloat(value, 64)
+		case "X-WECHAT-TYPE":
+			contactType, _ := strconv.Atoi(value)
+			contact.Type = ContactType(contactType)
+		case "X-WECHAT-STABLEID":
+			contact.StableId = vCardUnescape(value)
+		case "X-WECHAT-MEMBER":
+			parts := vCardSplit(value)
+			for len(parts) < 3 {
+				parts = append(parts, "")
+			}
+			contact.Members = append(contact.Members, ExportedMember{
+				UserName:    parts[0],
+				NickName:    parts[1],
+				DisplayName: parts[2],
+			})
+		}
+	}
+
+	return contacts, nil
+}
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+func vCardEscape(s string) string {
+	return vCardEscaper.Replace(strings.Replace(s, "\r", "", -1))
+}
+
+func vCardUnescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			if r == 'n' || r == 'N' {
+				b.WriteRune('\n')
+			} else {
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 按未转义的分号拆分结构化字段
+func vCardSplit(s string) []string {
+	parts := []string{}
+	start := 0
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ';':
+			parts = append(parts, vCardUnescape(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, vCardUnescape(s[start:]))
+}
+
+// vCard每行最多的字节数, 不含换行
+const vCardLineOctets = 75
+
+// 按RFC 6350折行, 续行以空格开头, 不拆分UTF-8字符
+func vCardFold(line string) string {
+	if len(line) <= vCardLineOctets {
+		return line
+	}
+
+	folded := new(strings.Builder)
+	limit := vCardLineOctets
+	for len(line) > limit {
+		end := limit
+		for end > 0 && !utf8.RuneStart(line[end]) {
+			end--
+		}
+		folded.WriteString(line[:end])
+		folded.WriteString("\r\n ")
+		line = line[end:]
+		// 续行开头的空格占一个字节
+		limit = vCardLineOctets - 1
+	}
+	folded.WriteString(line)
+	return folded.String()
+}
+
+// 合并折行, 单行超过1MB时返回错误
+func vCardUnfold(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// 通讯录差异
+type ContactDiff struct {
+	Added   []ExportedContact
+	Removed []ExportedContact
+	Renamed []ContactRename
+}
+
+// 改名的联系人
+type ContactRename struct {
+	Old ExportedContact
+	New ExportedContact
+}
+
+// 对比两次导出的通讯录; UserName每次登录都会变化, 依次按稳定ID、UserName、微信号、备注名、昵称匹配同一联系人
+func DiffContacts(oldContacts []ExportedContact, newContacts []ExportedContact) ContactDiff {
+	diff := ContactDiff{}
+	oldMatched := make([]bool, len(oldContacts))
+	newMatched := make([]bool, len(newContacts))
+
+	keys := []func(contact ExportedContact) string{
+		func(contact ExportedContact) string { return contact.StableId },
+		func(contact ExportedContact) string { return contact.UserName },
+		func(contact ExportedContact) string { return contact.Alias },
+		func(contact ExportedContact) string { return contact.RemarkName },
+		func(contact ExportedContact) string { return contact.NickName },
+	}
+
+	for _, key := range keys {
+		index := map[string]int{}
+		for i, contact := range oldContacts {
+			k := key(contact)
+			if oldMatched[i] || len(k) == 0 {
+				continue
+			}
+			index[fmt.Sprintf("%d|%s", contact.Type, k)] = i
+		}
+
+		for j, contact := range newContacts {
+			k := key(contact)
+			if newMatched[j] || len(k) == 0 {
+				continue
+			}
+			i, found := index[fmt.Sprintf("%d|%s", contact.Type, k)]
+			if !found || oldMatched[i] {
+				continue
+			}
+
+			oldMatched[i] = true
+			newMatched[j] = true
+			old := oldContacts[i]
+			if old.NickName != contact.NickName || old.RemarkName != contact.RemarkName {
+				diff.Renamed = append(diff.Renamed, ContactRename{Old: old, New: contact})
+			}
+		}
+	}
+
+	for i, contact := range oldContacts {
+		if !oldMatched[i] {
+			diff.Removed = append(diff.Removed, contact)
+		}
+	}
+	for j, contact := range newContacts {
+		if !newMatched[j] {
+			diff.Added = append(diff.Added, contact)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,92 @@
+package wxchat
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestContactsRoundTrip(t *testing.T) {
+	contacts := []ExportedContact{
+		{
+			UserName:   "@a",
+			NickName:   "张三, \"Zhang\"",
+			RemarkName: "老张;同事",
+			Alias:      "zhangsan",
+			Province:   "山东",
+			City:       "青岛",
+			Sex:        1,
+			Signature:  "第一行\n第二行\\",
+			Type:       Friend,
+			StableId:   "uin:123",
+		},
+		{
+			UserName: "@@g",
+			NickName: "群聊",
+			Type:     Group,
+			Members: []ExportedMember{
+				{UserName: "@a", NickName: "张三", DisplayName: "老张"},
+				{UserName: "@b", NickName: "李四;Li", DisplayName: ""},
+			},
+		},
+	}
+
+	for _, format := range []ExportFormat{EXPORT_JSON, EXPORT_CSV, EXPORT_VCARD} {
+		buffer := new(bytes.Buffer)
+		if err := WriteContacts(buffer, contacts, format); err != nil {
+			t.Fatalf("format %d: write: %v", format, err)
+		}
+		got, err := ReadContacts(buffer, format)
+		if err != nil {
+			t.Fatalf("format %d: read: %v", format, err)
+		}
+		if !reflect.DeepEqual(got, contacts) {
+			t.Errorf("format %d:\ngot  %+v\nwant %+v", format, got, contacts)
+		}
+	}
+}
+
+func TestVCardFoldsLongLines(t *testing.T) {
+	contacts := []ExportedContact{{
+		UserName:   "@a",
+		NickName:   strings.Repeat("昵", 40),
+		RemarkName: strings.Repeat("很长的备注名", 10),
+		Signature:  strings.Repeat("签名a", 50),
+		Type:       Friend,
+	}}
+
+	buffer := new(bytes.Buffer)
+	if err := WriteContacts(buffer, contacts, EXPORT_VCARD); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buffer.String(), "\r\n"), "\r\n") {
+		if len(line) > vCardLineOctets {
+			t.Errorf("line longer than %d octets: %q", vCardLineOctets, line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+	if !strings.Contains(buffer.String(), "\r\n ") {
+		t.Fatal("long lines not folded")
+	}
+
+	got, err := ReadContacts(buffer, EXPORT_VCARD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, contacts) {
+		t.Errorf("got %+v, want %+v", got, contacts)
+	}
+}
+
+func TestVCardLineTooLong(t *testing.T) {
+	card := "BEGIN:VCARD\r\nNOTE:" + strings.Repeat("a", 2*1024*1024) + "\r\nEND:VCARD\r\n"
+	_, err := ReadContacts(strings.NewReader(card), EXPORT_VCARD)
+	if err != bufio.ErrTooLong {
+		t.Fatalf("got %v, want %v", err, bufio.ErrTooLong)
+	}
+}
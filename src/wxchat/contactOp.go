@@ -0,0 +1,206 @@
+package wxchat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// 置顶联系人的ContactFlag标志位
+const contactFlagTop = 2048
+
+// 批量修改备注时每次请求的间隔, 实际间隔会再加上随机抖动, 为0时不等待
+var OpLogInterval = time.Second * 2
+
+type opLogResponse struct {
+	Response
+}
+
+// 单条备注修改结果
+type RemarkResult struct {
+	Line       int
+	Key        string
+	UserName   string
+	RemarkName string
+	Err        error
+}
+
+// 批量修改备注报告
+type RemarkReport struct {
+	Success int
+	Failed  int
+	Results []RemarkResult
+}
+
+// 修改联系人备注名
+func (wx *WxChat) SetRemarkName(userName string, remarkName string) error {
+	err := wx.opLog(map[string]interface{}{
+		"UserName":   userName,
+		"CmdId":      2,
+		"RemarkName": remarkName,
+	})
+	if err != nil {
+		wx.log(moduleContacts).Errorw("Set RemarkName Error.", "userName", userName, "err", err)
+		return err
+	}
+
+	// 新的备注名固定到原来的稳定ID
+	wx.contacts.Update(userName, func(contact *Contact) {
+		contact.RemarkName = remarkName
+	})
+	wx.saveIdentities()
+	wx.triggerContactModifyEvent([]string{userName})
+
+	return nil
+}
+
+// 置顶或取消置顶联系人
+func (wx *WxChat) SetPinned(userName string, pinned bool) error {
+	op := 0
+	if pinned {
+		op = 1
+	}
+
+	err := wx.opLog(map[string]interface{}{
+		"UserName": userName,
+		"CmdId":    3,
+		"OP":       op,
+	})
+	if err != nil {
+		wx.log(moduleContacts).Errorw("Set Pinned Error.", "userName", userName, "err", err)
+		return err
+	}
+
+	wx.contacts.Update(userName, func(contact *Contact) {
+		flag := int64(contact.ContactFlag)
+		if pinned {
+			flag |= contactFlagTop
+		} else {
+			flag &^= contactFlagTop
+		}
+		contact.ContactFlag = float64(flag)
+	})
+	wx.triggerContactModifyEvent([]string{userName})
+
+	return nil
+}
+
+// 从CSV批量修改备注名, 每行为"联系人,新备注", 联系人可以是UserName、备注名、昵称或微信号
+func (wx *WxChat) SetRemarkNamesFromCSV(r io.Reader) (*RemarkReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// 空行会被跳过, 行号以读取位置为准
+	type csvRow struct {
+		line   int
+		fields []string
+	}
+	rows := []csvRow{}
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, csvRow{line: line, fields: fields})
+	}
+
+	report := &RemarkReport{}
+	requested := false
+	for _, record := range rows {
+		row := record.fields
+		if len(row) == 0 || (len(row) == 1 && len(strings.TrimSpace(row[0])) == 0) {
+			continue
+		}
+
+		result := RemarkResult{Line: record.line, Key: strings.TrimSpace(row[0])}
+		if len(row) < 2 {
+			result.Err = errors.New("CSV需要两列: 联系人,新备注")
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		result.RemarkName = strings.TrimSpace(row[1])
+		result.UserName, result.Err = wx.resolveUserName(result.Key)
+
+		if result.Err == nil {
+			if requested && OpLogInterval > 0 {
+				time.Sleep(OpLogInterval + time.Duration(rand.Int63n(int64(time.Second))))
+			}
+			requested = true
+			result.Err = wx.SetRemarkName(result.UserName, result.RemarkName)
+		}
+
+		if result.Err == nil {
+			report.Success++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	report.Failed = len(report.Results) - report.Success
+	wx.log(moduleContacts).Infow("Set RemarkNames From CSV.", "success", report.Success, "failed", report.Failed)
+
+	return report, nil
+}
+
+// 根据UserName或名称找到联系人的UserName
+func (wx *WxChat) resolveUserName(key string) (string, error) {
+	if strings.HasPrefix(key, "@") && wx.contacts.Has(key) {
+		return key, nil
+	}
+
+	contact, err := wx.FindContact(ContactQuery{
+		Keyword: key,
+		Mode:    MATCH_EXACT,
+	})
+	if err != nil {
+		return "", err
+	}
+	return contact.UserName, nil
+}
+
+// 联系人操作请求
+func (wx *WxChat) opLog(params map[string]interface{}) error {
+	opLogApi := strings.Replace(wxChatApi["opLogApi"], "{host}", wx.host, 1)
+	opLogApi = strings.Replace(opLogApi, "{pass_ticket}", wx.passTicket, 1)
+
+	params["BaseRequest"] = wx.baseRequest
+
+	buffer := new(bytes.Buffer)
+	enc := json.NewEncoder(buffer)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(params)
+	if err != nil {
+		return err
+	}
+
+	respContent, err := wx.httpClient.post(opLogApi, buffer.Bytes(), time.Second*5, &httpHeader{
+		ContentType: "application/json;charset=utf-8",
+		Host:        wx.host,
+		Referer:     "https://" + wx.host + "/?&lang=zh_CN",
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp opLogResponse
+	err = json.Unmarshal([]byte(respContent), &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.BaseResponse == nil || resp.BaseResponse.Ret != 0 {
+		return errors.New("OpLog Error")
+	}
+
+	return nil
+}
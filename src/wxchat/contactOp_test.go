@@ -0,0 +1,99 @@
+package wxchat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetRemarkNameAndPinned(t *testing.T) {
+	wx, stub := newStubWxChat(t, nil)
+	wx.contacts.Put(&Contact{UserName: "@a", NickName: "a", Type: Friend})
+
+	modified := []string{}
+	wx.SetListener(CONTACT_MODIFY_EVENT, func(event Event) {
+		modified = append(modified, event.Data.(ContactModifyEventData).UserNames...)
+	})
+
+	if err := wx.SetRemarkName("@a", "老A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wx.SetPinned("@a", true); err != nil {
+		t.Fatal(err)
+	}
+
+	contact, _ := wx.contacts.Get("@a")
+	if contact.RemarkName != "老A" || int64(contact.ContactFlag)&contactFlagTop == 0 {
+		t.Fatalf("got %+v", contact)
+	}
+	// 事件同步触发
+	if strings.Join(modified, ",") != "@a,@a" {
+		t.Fatalf("modify events: got %v", modified)
+	}
+
+	requests := stub.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if body := requests[0].Body; body["CmdId"] != float64(2) || body["RemarkName"] != "老A" || body["UserName"] != "@a" {
+		t.Errorf("remark request: got %v", body)
+	}
+	if body := requests[1].Body; body["CmdId"] != float64(3) || body["OP"] != float64(1) {
+		t.Errorf("pin request: got %v", body)
+	}
+}
+
+func TestSetRemarkNamesFromCSV(t *testing.T) {
+	interval := OpLogInterval
+	OpLogInterval = 0
+	defer func() { OpLogInterval = interval }()
+
+	wx, _ := newStubWxChat(t, func(req stubRequest) string {
+		if req.Body["UserName"] == "@b" {
+			return `{"BaseResponse":{"Ret":1,"ErrMsg":"fail"}}`
+		}
+		return `{"BaseResponse":{"Ret":0,"ErrMsg":""}}`
+	})
+	wx.contacts.Put(&Contact{UserName: "@a", RemarkName: "A", Type: Friend})
+	wx.contacts.Put(&Contact{UserName: "@b", NickName: "Bob", Type: Friend})
+
+	csv := "A, 新A\n\nBob,新B\nnobody,x\nonlyone\n@a,再改\n"
+	report, err := wx.SetRemarkNamesFromCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line     int
+		userName string
+		remark   string
+		ok       bool
+	}{
+		{1, "@a", "新A", true},
+		{3, "@b", "新B", false},
+		{4, "", "x", false},
+		{5, "", "", false},
+		{6, "@a", "再改", true},
+	}
+	if len(report.Results) != len(tests) {
+		t.Fatalf("got %d results, want %d: %+v", len(report.Results), len(tests), report.Results)
+	}
+	for i, tt := range tests {
+		result := report.Results[i]
+		if result.Line != tt.line || result.UserName != tt.userName || result.RemarkName != tt.remark || (result.Err == nil) != tt.ok {
+			t.Errorf("result %d: got %+v, want %+v", i, result, tt)
+		}
+	}
+	if report.Results[2].Err != ErrContactNotFound {
+		t.Errorf("unknown contact: got %v", report.Results[2].Err)
+	}
+	if report.Success != 2 || report.Failed != 3 {
+		t.Errorf("got success %d failed %d, want 2 and 3", report.Success, report.Failed)
+	}
+	if contact, _ := wx.contacts.Get("@a"); contact.RemarkName != "再改" {
+		t.Errorf("remark: got %q", contact.RemarkName)
+	}
+
+	if _, err := wx.SetRemarkNamesFromCSV(strings.NewReader("\"unterminated,x\n")); err == nil {
+		t.Error("want error for malformed CSV")
+	}
+}
@@ -0,0 +1,242 @@
+package wxchat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 匹配方式, 宽松的方式同样接受更严格的匹配
+type MatchMode int
+
+const (
+	MATCH_EXACT     MatchMode = iota // 完全相同, 区分大小写
+	MATCH_PREFIX                     // 前缀
+	MATCH_SUBSTRING                  // 包含
+	MATCH_FUZZY                      // 模糊(编辑距离)
+)
+
+// 联系人查询条件, 为空的字段不参与匹配
+type ContactQuery struct {
+	Keyword     string // 匹配任意名称字段
+	NickName    string
+	RemarkName  string
+	Alias       string
+	PinYin      string // 匹配昵称和备注的拼音首字母/全拼
+	Province    string
+	City        string
+	Sex         float64     // 0不限, 1男, 2女
+	ContactType ContactType // 0不限
+	Mode        MatchMode
+	Limit       int // 0不限
+}
+
+// 查询结果
+type ContactMatch struct {
+	Contact Contact
+	Score   float64
+}
+
+var ErrContactNotFound = errors.New("未找到该联系人")
+
+var ErrEmptyRemarkName = errors.New("备注名不能为空")
+
+// 查询到多个同样匹配的联系人
+type AmbiguousContactError struct {
+	Query      ContactQuery
+	Candidates []Contact
+}
+
+func (e *AmbiguousContactError) Error() string {
+	names := []string{}
+	for _, contact := range e.Candidates {
+		names = append(names, contactName(contact))
+	}
+	return fmt.Sprintf("找到%d个匹配的联系人: %s", len(e.Candidates), strings.Join(names, ", "))
+}
+
+// 模糊匹配的最低相似度
+const fuzzyThreshold = 0.5
+
+// 按条件查询联系人, 结果按匹配度排序
+func (wx *WxChat) FindContacts(query ContactQuery) []ContactMatch {
+	matches := []ContactMatch{}
+
+	wx.contacts.Range(func(contact Contact) bool {
+		score, ok := query.match(contact)
+		if ok {
+			matches = append(matches, ContactMatch{Contact: contact, Score: score})
+		}
+		return true
+	})
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return contactName(matches[i].Contact) < contactName(matches[j].Contact)
+	})
+
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+
+	return matches
+}
+
+// 查询唯一的联系人, 有多个同分结果时返回AmbiguousContactError
+func (wx *WxChat) FindContact(query ContactQuery) (Contact, error) {
+	all := query
+	all.Limit = 0
+	matches := wx.FindContacts(all)
+	if len(matches) == 0 {
+		return Contact{}, ErrContactNotFound
+	}
+
+	candidates := []Contact{}
+	for _, match := range matches {
+		if match.Score == matches[0].Score {
+			candidates = append(candidates, match.Contact)
+		}
+	}
+
+	if len(candidates) > 1 {
+		return Contact{}, &AmbiguousContactError{
+			Query:      query,
+			Candidates: candidates,
+		}
+	}
+
+	return matches[0].Contact, nil
+}
+
+// 计算联系人的匹配度, 所有条件都满足时ok为true
+func (query ContactQuery) match(contact Contact) (score float64, ok bool) {
+	if query.ContactType != 0 && query.ContactType != contact.Type {
+		return 0, false
+	}
+	if query.Sex != 0 && query.Sex != contact.Sex {
+		return 0, false
+	}
+	if len(query.Province) > 0 && !strings.EqualFold(query.Province, contact.Province) {
+		return 0, false
+	}
+	if len(query.City) > 0 && !strings.EqualFold(query.City, contact.City) {
+		return 0, false
+	}
+
+	fields := []struct {
+		value  string
+		target []string
+	}{
+		{query.NickName, []string{contact.NickName}},
+		{query.RemarkName, []string{contact.RemarkName}},
+		{query.Alias, []string{contact.Alias}},
+		{query.PinYin, []string{contact.PYInitial, contact.PYQuanPin, contact.RemarkPYInitial, contact.RemarkPYQuanPin}},
+		{query.Keyword, []string{contact.RemarkName, contact.NickName, contact.Alias, contact.PYInitial, contact.PYQuanPin, contact.RemarkPYInitial, contact.RemarkPYQuanPin}},
+	}
+
+	matched := false
+	for _, field := range fields {
+		if len(field.value) == 0 {
+			continue
+		}
+
+		best := 0.0
+		for _, target := range field.target {
+			if s := matchScore(field.value, target, query.Mode); s > best {
+				best = s
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+		matched = true
+	}
+
+	// 只有过滤条件时所有满足的联系人同分
+	if !matched {
+		return 1, true
+	}
+
+	return score, true
+}
+
+// 单个字段的匹配度, 0为不匹配
+func matchScore(value string, target string, mode MatchMode) float64 {
+	if len(target) == 0 {
+		return 0
+	}
+	if value == target {
+		return 1
+	}
+	if mode == MATCH_EXACT {
+		return 0
+	}
+	value = strings.ToLower(value)
+	target = strings.ToLower(target)
+
+	switch {
+	case value == target:
+		return 0.9
+	case mode >= MATCH_PREFIX && strings.HasPrefix(target, value):
+		return 0.8
+	case mode >= MATCH_SUBSTRING && strings.Contains(target, value):
+		return 0.6
+	case mode >= MATCH_FUZZY:
+		similarity := 1 - float64(levenshtein(value, target))/float64(maxInt(len([]rune(value)), len([]rune(target))))
+		if similarity >= fuzzyThreshold {
+			return 0.5 * similarity
+		}
+	}
+
+	return 0
+}
+
+// 编辑距离
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// 联系人展示名, 优先备注名
+func contactName(contact Contact) string {
+	if len(contact.RemarkName) > 0 {
+		return contact.RemarkName
+	}
+	return contact.NickName
+}
@@ -0,0 +1,64 @@
+package wxchat
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	logs "wxchat/log"
+)
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		value  string
+		target string
+		mode   MatchMode
+		want   float64
+	}{
+		{"Tom", "Tom", MATCH_EXACT, 1},
+		{"tom", "Tom", MATCH_EXACT, 0},
+		{"tom", "Tom", MATCH_PREFIX, 0.9},
+		{"To", "Tom", MATCH_EXACT, 0},
+		{"To", "Tom", MATCH_PREFIX, 0.8},
+		{"om", "Tom", MATCH_PREFIX, 0},
+		{"om", "Tom", MATCH_SUBSTRING, 0.6},
+		{"Tom", "", MATCH_FUZZY, 0},
+	}
+
+	for _, tt := range tests {
+		if got := matchScore(tt.value, tt.target, tt.mode); got != tt.want {
+			t.Errorf("matchScore(%q, %q, %d) = %v, want %v", tt.value, tt.target, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestSearchContact(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.contacts.Put(&Contact{UserName: "@a", RemarkName: "Tom", Type: Friend})
+	wx.contacts.Put(&Contact{UserName: "@b", RemarkName: "tom", Type: Friend})
+	wx.contacts.Put(&Contact{UserName: "@c", RemarkName: "Jerry", Type: Friend})
+	wx.contacts.Put(&Contact{UserName: "@d", RemarkName: "Jerry", Type: Friend})
+
+	tests := []struct {
+		remarkName string
+		userName   string
+		err        error
+	}{
+		{"Tom", "@a", nil},
+		{"tom", "@b", nil},
+		{"TOM", "", ErrContactNotFound},
+		{"To", "", ErrContactNotFound},
+		{"", "", ErrEmptyRemarkName},
+	}
+
+	for _, tt := range tests {
+		userName, err := wx.SearchContact(tt.remarkName)
+		if userName != tt.userName || !errors.Is(err, tt.err) {
+			t.Errorf("SearchContact(%q) = %q, %v; want %q, %v", tt.remarkName, userName, err, tt.userName, tt.err)
+		}
+	}
+
+	var ambiguous *AmbiguousContactError
+	if _, err := wx.SearchContact("Jerry"); !errors.As(err, &ambiguous) || len(ambiguous.Candidates) != 2 {
+		t.Errorf("SearchContact(\"Jerry\"): want AmbiguousContactError with 2 candidates, got %v", err)
+	}
+}
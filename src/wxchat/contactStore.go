@@ -0,0 +1,369 @@
+package wxchat
+
+import (
+	"sort"
+	"sync"
+)
+
+// 并发安全的联系人存储, 读取时返回副本
+type ContactStore struct {
+	mn           sync.RWMutex
+	contacts     map[string]*Contact
+	byRemarkName map[string]map[string]bool
+	byNickName   map[string]map[string]bool
+	byAlias      map[string]map[string]bool
+	byPYQuanPin  map[string]map[string]bool
+	byType       map[ContactType]map[string]bool
+	byStableId   map[string]string
+	members      map[string]map[string]*Contact // 群成员的联系人详情缓存
+	resolver     *identityResolver
+}
+
+func NewContactStore() *ContactStore {
+	store := &ContactStore{}
+	store.reset()
+	return store
+}
+
+func (store *ContactStore) reset() {
+	store.contacts = map[string]*Contact{}
+	store.byRemarkName = map[string]map[string]bool{}
+	store.byNickName = map[string]map[string]bool{}
+	store.byAlias = map[string]map[string]bool{}
+	store.byPYQuanPin = map[string]map[string]bool{}
+	store.byType = map[ContactType]map[string]bool{}
+	store.byStableId = map[string]string{}
+	store.members = map[string]map[string]*Contact{}
+}
+
+// 获取联系人副本
+func (store *ContactStore) Get(userName string) (Contact, bool) {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+
+	contact, found := store.contacts[userName]
+	if !found {
+		return Contact{}, false
+	}
+	return copyContact(contact), true
+}
+
+// 获取群成员副本
+func (store *ContactStore) GetMember(groupUserName string, userName string) (Member, bool) {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+
+	group, found := store.contacts[groupUserName]
+	if !found {
+		return Member{}, false
+	}
+	member, found := group.MemberMap[userName]
+	if !found || member == nil {
+		return Member{}, false
+	}
+	return *member, true
+}
+
+// 是否存在该联系人
+func (store *ContactStore) Has(userName string) bool {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+	_, found := store.contacts[userName]
+	return found
+}
+
+// 联系人数量
+func (store *ContactStore) Len() int {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+	return len(store.contacts)
+}
+
+// 添加或替换联系人, 保存的是副本
+func (store *ContactStore) Put(contact *Contact) {
+	c := copyContact(contact)
+
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	if old, found := store.contacts[c.UserName]; found {
+		store.unindex(old)
+	}
+	store.contacts[c.UserName] = &c
+	store.index(&c)
+}
+
+// 修改联系人, 修改完成后重建索引
+func (store *ContactStore) Update(userName string, modify func(contact *Contact)) bool {
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	contact, found := store.contacts[userName]
+	if !found {
+		return false
+	}
+	store.unindex(contact)
+	modify(contact)
+	store.index(contact)
+	return true
+}
+
+// 在锁内根据旧值生成新联系人并替换, 返回替换前后的副本; build返回nil时不修改
+func (store *ContactStore) Swap(userName string, build func(old *Contact) *Contact) (Contact, Contact, bool) {
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	var old *Contact
+	oldCopy := Contact{}
+	if contact, found := store.contacts[userName]; found {
+		oldCopy = copyContact(contact)
+		c := copyContact(contact)
+		old = &c
+	}
+
+	contact := build(old)
+	if contact == nil {
+		return oldCopy, oldCopy, false
+	}
+	c := copyContact(contact)
+	c.UserName = userName
+	if old != nil {
+		store.unindex(store.contacts[userName])
+	}
+	store.contacts[userName] = &c
+	store.index(&c)
+	return oldCopy, copyContact(&c), old != nil
+}
+
+// 删除联系人
+func (store *ContactStore) Delete(userName string) bool {
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	contact, found := store.contacts[userName]
+	if !found {
+		return false
+	}
+	store.unindex(contact)
+	delete(store.contacts, userName)
+	delete(store.members, userName)
+	return true
+}
+
+// 获取缓存的群成员联系人详情
+func (store *ContactStore) GetMemberContact(groupUserName string, userName string) (Contact, bool) {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+
+	contact, found := store.members[groupUserName][userName]
+	if !found {
+		return Contact{}, false
+	}
+	return copyContact(contact), true
+}
+
+// 缓存群成员联系人详情
+func (store *ContactStore) PutMemberContact(groupUserName string, contact *Contact) {
+	c := copyContact(contact)
+
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	if store.members[groupUserName] == nil {
+		store.members[groupUserName] = map[string]*Contact{}
+	}
+	store.members[groupUserName][c.UserName] = &c
+}
+
+// 删除缓存的群成员联系人详情, userNames为nil时删除该群所有缓存
+func (store *ContactStore) DeleteMemberContacts(groupUserName string, userNames []string) {
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	if userNames == nil {
+		delete(store.members, groupUserName)
+		return
+	}
+	for _, userName := range userNames {
+		delete(store.members[groupUserName], userName)
+	}
+}
+
+// 清空并重新载入联系人
+func (store *ContactStore) Reset(contacts []*Contact) {
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	store.reset()
+	for _, contact := range contacts {
+		c := copyContact(contact)
+		store.contacts[c.UserName] = &c
+		store.index(&c)
+	}
+}
+
+// 所有联系人的快照, 按UserName排序
+func (store *ContactStore) Snapshot() []Contact {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+
+	contacts := make([]Contact, 0, len(store.contacts))
+	for _, contact := range store.contacts {
+		contacts = append(contacts, copyContact(contact))
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].UserName < contacts[j].UserName
+	})
+	return contacts
+}
+
+// 遍历联系人快照, f返回false时停止
+func (store *ContactStore) Range(f func(contact Contact) bool) {
+	for _, contact := range store.Snapshot() {
+		if !f(contact) {
+			return
+		}
+	}
+}
+
+// 按备注名查找
+func (store *ContactStore) FindByRemarkName(remarkName string) []Contact {
+	return store.lookup(&store.byRemarkName, remarkName)
+}
+
+// 按昵称查找
+func (store *ContactStore) FindByNickName(nickName string) []Contact {
+	return store.lookup(&store.byNickName, nickName)
+}
+
+// 按微信号查找
+func (store *ContactStore) FindByAlias(alias string) []Contact {
+	return store.lookup(&store.byAlias, alias)
+}
+
+// 按昵称全拼查找
+func (store *ContactStore) FindByPYQuanPin(pyQuanPin string) []Contact {
+	return store.lookup(&store.byPYQuanPin, pyQuanPin)
+}
+
+// 按稳定ID查找
+func (store *ContactStore) FindByStableId(stableId string) (Contact, bool) {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+
+	contact, found := store.contacts[store.byStableId[stableId]]
+	if !found {
+		return Contact{}, false
+	}
+	return copyContact(contact), true
+}
+
+// 映射表变化后重新解析所有联系人的稳定ID
+func (store *ContactStore) refreshStableIds() {
+	store.mn.Lock()
+	defer store.mn.Unlock()
+
+	for _, contact := range store.contacts {
+		store.unindex(contact)
+		store.index(contact)
+	}
+}
+
+// 按联系人类型查找
+func (store *ContactStore) FindByType(contactType ContactType) []Contact {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+	return store.collect(store.byType[contactType])
+}
+
+func (store *ContactStore) lookup(index *map[string]map[string]bool, key string) []Contact {
+	store.mn.RLock()
+	defer store.mn.RUnlock()
+	return store.collect((*index)[key])
+}
+
+// 需在持有锁时调用
+func (store *ContactStore) collect(userNames map[string]bool) []Contact {
+	contacts := []Contact{}
+	for userName := range userNames {
+		if contact, found := store.contacts[userName]; found {
+			contacts = append(contacts, copyContact(contact))
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].UserName < contacts[j].UserName
+	})
+	return contacts
+}
+
+func (store *ContactStore) index(contact *Contact) {
+	if store.resolver != nil {
+		contact.StableId = store.resolver.resolve(contact)
+	}
+	if len(contact.StableId) > 0 {
+		store.byStableId[contact.StableId] = contact.UserName
+	}
+
+	addIndex(store.byRemarkName, contact.RemarkName, contact.UserName)
+	addIndex(store.byNickName, contact.NickName, contact.UserName)
+	addIndex(store.byAlias, contact.Alias, contact.UserName)
+	addIndex(store.byPYQuanPin, contact.PYQuanPin, contact.UserName)
+
+	if store.byType[contact.Type] == nil {
+		store.byType[contact.Type] = map[string]bool{}
+	}
+	store.byType[contact.Type][contact.UserName] = true
+}
+
+func (store *ContactStore) unindex(contact *Contact) {
+	if store.byStableId[contact.StableId] == contact.UserName {
+		delete(store.byStableId, contact.StableId)
+	}
+	removeIndex(store.byRemarkName, contact.RemarkName, contact.UserName)
+	removeIndex(store.byNickName, contact.NickName, contact.UserName)
+	removeIndex(store.byAlias, contact.Alias, contact.UserName)
+	removeIndex(store.byPYQuanPin, contact.PYQuanPin, contact.UserName)
+	delete(store.byType[contact.Type], contact.UserName)
+}
+
+func addIndex(index map[string]map[string]bool, key string, userName string) {
+	if key == "" {
+		return
+	}
+	if index[key] == nil {
+		index[key] = map[string]bool{}
+	}
+	index[key][userName] = true
+}
+
+func removeIndex(index map[string]map[string]bool, key string, userName string) {
+	delete(index[key], userName)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// 深拷贝联系人, MemberMap指向新的MemberList
+func copyContact(contact *Contact) Contact {
+	c := *contact
+	if contact.MemberList != nil {
+		c.MemberList = make([]*Member, len(contact.MemberList))
+		for i, member := range contact.MemberList {
+			m := *member
+			c.MemberList[i] = &m
+		}
+	}
+	if contact.MemberMap != nil {
+		c.MemberMap = make(map[string]*Member, len(contact.MemberMap))
+		for _, member := range c.MemberList {
+			c.MemberMap[member.UserName] = member
+		}
+		for userName, member := range contact.MemberMap {
+			if _, found := c.MemberMap[userName]; !found {
+				m := *member
+				c.MemberMap[userName] = &m
+			}
+		}
+	}
+	return c
+}
@@ -3,8 +3,10 @@ package wxchat
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"wxchat/utils"
 )
@@ -52,7 +54,9 @@ type Contact struct {
 	KeyWord          string
 	EncryChatRoomId  string
 	IsOwner          float64
+	OwnerUin         float64 // 群主的Uin
 	Type             ContactType
+	StableId         string // 跨登录不变的ID
 }
 
 // 群组成员
@@ -83,12 +87,39 @@ type batchGetContactResponse struct {
 	ContactList []*Contact
 }
 
-// 初始化通讯录
-func (wx *WxChat) initContact() error {
+// 批量获取联系人时每页的数量和并发数
+const (
+	batchContactPageSize    = 50
+	batchContactConcurrency = 4
+)
+
+// 批量获取联系人的结果, 作为error返回时表示部分分页失败
+type BatchFetchReport struct {
+	Total   int
+	Fetched int
+	Failed  []BatchFetchFailure
+}
+
+// 获取失败的分页
+type BatchFetchFailure struct {
+	UserNames []string
+	Err       error
+}
+
+func (report *BatchFetchReport) Error() string {
+	failed := 0
+	for _, failure := range report.Failed {
+		failed += len(failure.UserNames)
+	}
+	return fmt.Sprintf("Fetch contacts partially failed. Total=%d, Fetched=%d, Failed=%d", report.Total, report.Fetched, failed)
+}
+
+// 初始化通讯录, 群详情部分获取失败时返回失败报告
+func (wx *WxChat) initContact() (*BatchFetchReport, error) {
 	seq := float64(-1)
 
 	var cts = []*Contact{}
-	wx.contacts = map[string]*Contact{}
+	contacts := map[string]*Contact{}
 
 	for seq != 0 {
 		if -1 == seq {
@@ -96,7 +127,7 @@ func (wx *WxChat) initContact() error {
 		}
 		contactList, s, err := wx.getContacts(seq)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		seq = s
 		cts = append(cts, contactList...)
@@ -116,19 +147,33 @@ func (wx *WxChat) initContact() error {
 		} else {
 			v.Type = Friend
 		}
-		wx.contacts[userName] = v
+		contacts[userName] = v
 	}
 
-	groups, _ := wx.fetchContacts(groupUserNames)
+	// 获取失败的群保留基本信息, 收到消息时再拉取成员
+	groups, report := wx.batchFetchContacts(contactListOf(groupUserNames))
+	if len(report.Failed) == 0 {
+		report = nil
+	} else {
+		wx.log(moduleContacts).Warnw("Batch Fetch Contacts Partially Failed.", "total", report.Total, "fetched", report.Fetched, "failed", len(report.Failed), "err", report)
+	}
 	for _, group := range groups {
 		group.MemberMap = map[string]*Member{}
 		for _, contact := range group.MemberList {
 			group.MemberMap[contact.UserName] = contact
 		}
-		wx.contacts[group.UserName] = group
+		group.Type = Group
+		contacts[group.UserName] = group
 	}
 
-	return nil
+	list := make([]*Contact, 0, len(contacts))
+	for _, contact := range contacts {
+		list = append(list, contact)
+	}
+	wx.contacts.Reset(list)
+	wx.saveIdentities()
+
+	return report, nil
 }
 
 // 获取联系人
@@ -154,17 +199,20 @@ func (wx *WxChat) getContacts(seq float64) ([]*Contact, float64, error) {
 	return resp.MemberList, resp.Seq, nil
 }
 
-// 获取联系人详情, 群组获取成员
-func (wx *WxChat) fetchContacts(userNames []string) ([]*Contact, error) {
-
-	var list []map[string]string
-
+// 生成批量获取联系人的请求列表
+func contactListOf(userNames []string) []map[string]string {
+	list := []map[string]string{}
 	for _, u := range userNames {
 		list = append(list, map[string]string{
 			"UserName":   u,
 			"ChatRoomId": "",
 		})
 	}
+	return list
+}
+
+// 获取联系人详情, 群组获取成员; list中每项为UserName和所在群的EncryChatRoomId
+func (wx *WxChat) fetchContacts(list []map[string]string) ([]*Contact, error) {
 
 	data, err := json.Marshal(map[string]interface{}{
 		"BaseRequest": wx.baseRequest,
@@ -182,6 +230,9 @@ func (wx *WxChat) fetchContacts(userNames []string) ([]*Contact, error) {
 		Host:    wx.host,
 		Referer: "https://" + wx.host + "/?&lang=zh_CN",
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	var resp batchGetContactResponse
 	err = json.Unmarshal([]byte(content), &resp)
@@ -189,24 +240,69 @@ func (wx *WxChat) fetchContacts(userNames []string) ([]*Contact, error) {
 		return nil, err
 	}
 
+	if resp.BaseResponse != nil && resp.BaseResponse.Ret != 0 {
+		return nil, fmt.Errorf("Batch Get Contact Error. Ret=%d", resp.BaseResponse.Ret)
+	}
+
 	return resp.ContactList, nil
 }
 
+// 分页批量获取联系人详情, 部分分页失败时返回已获取的联系人和失败报告
+func (wx *WxChat) batchFetchContacts(list []map[string]string) ([]*Contact, *BatchFetchReport) {
+	report := &BatchFetchReport{Total: len(list)}
+	contacts := []*Contact{}
+
+	var mn sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchContactConcurrency)
+
+	for start := 0; start < len(list); start += batchContactPageSize {
+		end := start + batchContactPageSize
+		if end > len(list) {
+			end = len(list)
+		}
+		page := list[start:end]
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			cts, err := wx.fetchContacts(page)
+
+			mn.Lock()
+			defer mn.Unlock()
+			if err != nil {
+				userNames := []string{}
+				for _, item := range page {
+					userNames = append(userNames, item["UserName"])
+				}
+				report.Failed = append(report.Failed, BatchFetchFailure{
+					UserNames: userNames,
+					Err:       err,
+				})
+				return
+			}
+			contacts = append(contacts, cts...)
+			report.Fetched += len(cts)
+		}()
+	}
+	wg.Wait()
+
+	return contacts, report
+}
+
 // 根据UserName更新联系人
 func (wx *WxChat) updateContact(userNames []string) error {
 
-	contacts, err := wx.fetchContacts(userNames)
+	contacts, report := wx.batchFetchContacts(contactListOf(userNames))
 
-	if err != nil || len(contacts) != 1 {
+	if len(contacts) == 0 {
 		return errors.New("Fetch contacts failed.")
 	}
 
 	for _, contact := range contacts {
-		contact.MemberMap = map[string]*Member{}
-		for _, member := range contact.MemberList {
-			contact.MemberMap[member.UserName] = member
-		}
-
 		if contact.VerifyFlag/8 != 0 {
 			contact.Type = Official
 		} else if strings.HasPrefix(contact.UserName, "@@") {
@@ -215,54 +311,125 @@ func (wx *WxChat) updateContact(userNames []string) error {
 			contact.Type = Friend
 		}
 
-		wx.contacts[contact.UserName] = contact
+		if Group == contact.Type {
+			wx.putGroup(contact)
+			continue
+		}
+
+		contact.MemberMap = map[string]*Member{}
+		for _, member := range contact.MemberList {
+			contact.MemberMap[member.UserName] = member
+		}
+		wx.contacts.Put(contact)
+	}
+	wx.saveIdentities()
+
+	if len(report.Failed) > 0 {
+		return report
 	}
 
 	return nil
 }
 
+// 获取群成员的联系人详情, 已获取过的直接从缓存返回
+func (wx *WxChat) FetchGroupMembers(groupUserName string, userNames []string) ([]Contact, error) {
+	group, found := wx.contacts.Get(groupUserName)
+	if !found {
+		return nil, errors.New("Group Not Found. [group]:" + groupUserName)
+	}
+
+	members := []Contact{}
+	list := []map[string]string{}
+	for _, userName := range userNames {
+		contact, found := wx.contacts.GetMemberContact(groupUserName, userName)
+		if found {
+			members = append(members, contact)
+			continue
+		}
+		list = append(list, map[string]string{
+			"UserName":        userName,
+			"EncryChatRoomId": group.EncryChatRoomId,
+		})
+	}
+
+	if len(list) == 0 {
+		return members, nil
+	}
+
+	contacts, report := wx.batchFetchContacts(list)
+	for _, contact := range contacts {
+		contact.Type = Friend
+		wx.contacts.PutMemberContact(groupUserName, contact)
+		members = append(members, copyContact(contact))
+	}
+
+	if len(report.Failed) > 0 {
+		return members, report
+	}
+
+	return members, nil
+}
+
 // 更新联系人
 func (wx *WxChat) contactsModify(cts []map[string]interface{}) error {
 	userNames := []string{}
-	userNamesStr := ""
 	for _, newContact := range cts {
-		userNames = append(userNames, newContact["UserName"].(string))
-		userNamesStr += newContact["UserName"].(string) + ", "
+		userName := newContact["UserName"].(string)
+		userNames = append(userNames, userName)
+
+		// 头像地址变化时删除缓存
+		headImgUrl, ok := newContact["HeadImgUrl"].(string)
+		if oldContact, found := wx.contacts.Get(userName); ok && found && oldContact.HeadImgUrl != headImgUrl {
+			wx.invalidateAvatar(userName)
+		}
 	}
 
-	wx.logger.Notice("Contacts Modify. UserNames: " + userNamesStr)
+	wx.log(moduleContacts).Noticew("Contacts Modify.", "userNames", userNames)
 
 	return wx.updateContact(userNames)
 }
 
 // 删除联系人
 func (wx *WxChat) contactsDelete(cts []map[string]interface{}) {
-	userNamesStr := ""
+	userNames := []string{}
 	for _, contact := range cts {
-		delete(wx.contacts, contact["UserName"].(string))
-		userNamesStr += contact["UserName"].(string) + ", "
+		wx.contacts.Delete(contact["UserName"].(string))
+		userNames = append(userNames, contact["UserName"].(string))
 	}
 
-	wx.logger.Notice("Contacts Delete. UserNames: " + userNamesStr)
+	wx.log(moduleContacts).Noticew("Contacts Delete.", "userNames", userNames)
 
 }
 
-// 查找联系人userName
+// 根据备注名查找联系人userName, 区分大小写; 备注名为空时返回ErrEmptyRemarkName, 有多个同名联系人时返回AmbiguousContactError
 func (wx *WxChat) SearchContact(remarkName string) (string, error) {
-	userName := ""
-	for k, v := range wx.contacts {
-		if v.RemarkName == remarkName {
-			userName = k
-			break
-		}
+	if len(remarkName) == 0 {
+		return "", ErrEmptyRemarkName
+	}
+
+	// 备注名完全相同, 区分大小写
+	contacts := wx.contacts.FindByRemarkName(remarkName)
+	if len(contacts) == 0 {
+		wx.log(moduleContacts).Errorw("Search Contact Failed.", "remarkName", remarkName, "err", ErrContactNotFound)
+		return "", ErrContactNotFound
 	}
-	if userName == "" {
-		wx.logger.Error("未找到该联系人")
-		return "", errors.New("未找到该联系人")
+	if len(contacts) > 1 {
+		err := &AmbiguousContactError{
+			Query:      ContactQuery{RemarkName: remarkName, Mode: MATCH_EXACT},
+			Candidates: contacts,
+		}
+		wx.log(moduleContacts).Errorw("Search Contact Failed.", "remarkName", remarkName, "err", err)
+		return "", err
 	}
-	return userName, nil
+	return contacts[0].UserName, nil
 }
 
 func (wx *WxChat) GetRemarkName(userName string) string {
-	return wx.contacts[userName].RemarkName
+	contact, _ := wx.contacts.Get(userName)
+	return contact.RemarkName
+}
+
+// 联系人存储
+func (wx *WxChat) Contacts() *ContactStore {
+	return wx.contacts
 }
@@ -2,6 +2,8 @@ package wxchat
 
 import (
 	"fmt"
+	"html"
+	"regexp"
 	"strings"
 	"time"
 	"wxchat/utils"
@@ -11,17 +13,20 @@ import (
 type EventType int
 
 const (
-	_                    EventType = iota
-	GEN_UUID_EVENT                 // 生成Uuid
-	SCAN_CODE_EVENT                // 已扫码，未确认
-	CONFIRM_AUTH_EVENT             // 已确认授权登录
-	LOGIN_EVENT                    // 已登录
-	INIT_EVENT                     // 初始化完成
-	CONTACTS_INIT_EVENT            // 联系人初始化完
-	LISTEN_FAILED_EVENT            // 同步微信失败,可能为客户端已退出 | 被微信反爬虫
-	CONTACT_MODIFY_EVENT           // 联系人改变了
-	CONTACT_DELETE_EVENT           // 联系人删除事件
-	MESSAGE_EVENT                  // 消息
+	_                         EventType = iota
+	GEN_UUID_EVENT                      // 生成Uuid
+	SCAN_CODE_EVENT                     // 已扫码，未确认
+	CONFIRM_AUTH_EVENT                  // 已确认授权登录
+	LOGIN_EVENT                         // 已登录
+	INIT_EVENT                          // 初始化完成
+	CONTACTS_INIT_EVENT                 // 联系人初始化完
+	LISTEN_FAILED_EVENT                 // 同步微信失败,可能为客户端已退出 | 被微信反爬虫
+	CONTACT_MODIFY_EVENT                // 联系人改变了
+	CONTACT_DELETE_EVENT                // 联系人删除事件
+	MESSAGE_EVENT                       // 消息
+	GROUP_MEMBER_JOIN_EVENT             // 群成员加入
+	GROUP_MEMBER_LEAVE_EVENT            // 群成员退出
+	GROUP_MEMBER_RENAME_EVENT           // 群成员修改昵称
 )
 
 // 事件体
@@ -59,6 +64,7 @@ type InitEventData struct {
 // 通讯录初始化事件数据
 type ContactsInitEventData struct {
 	ContactsCount int
+	FetchReport   *BatchFetchReport // 群详情部分获取失败时不为nil, 失败的群在收到消息时再获取
 }
 
 // 同步微信失败事件数据
@@ -77,22 +83,48 @@ type ContactDeleteEventData struct {
 	UserNames []string
 }
 
+// 群成员加入/退出事件数据
+type GroupMemberEventData struct {
+	Group   Contact
+	Members []Member
+}
+
+// 群成员改名事件数据
+type GroupMemberRenameEventData struct {
+	Group   Contact
+	Renames []MemberRename
+}
+
+// 群成员改名信息
+type MemberRename struct {
+	Member         Member
+	OldNickName    string
+	OldDisplayName string
+}
+
 // 消息事件数据
 type MessageEventData struct {
+	MsgId          string
+	CreateTime     int64 // 消息的发送时间
 	MessageType    MessageType
 	IsGroupMessage bool
 	IsSendByMySelf bool
 	IsAtMe         bool
+	AtUserNames    []string // 被@成员的UserName, @所有人时包含MentionAll
 	MediaUrl       string
-	Content        string
+	Content        string // 文本消息为解码后的纯文本, 其他类型同RawContent
+	RawContent     string // 未解码的内容, 群消息不含发送人前缀
 	FromUserName   string
 	FromUserInfo   Contact
 	SenderUserInfo SenderUserInfo
-	SenderUserId   string // 根据SendUserName生成ID
+	SenderUserId   string // 根据SendUserName生成ID, 每次登录都会变化, 请使用SenderStableId
+	SenderStableId string // 发送人跨登录不变的ID
 	ToUserName     string
 	ToUserInfo     Contact
 	RecommendInfo  map[string]interface{}
+	FriendRequest  *FriendRequest // 好友请求消息时不为nil
 	LocationInfo   LocationInfo
+	RevokedMsgId   string // 撤回通知(MsgType为10002)中被撤回的消息ID
 	OriginalMsg    map[string]interface{}
 }
 
@@ -227,7 +259,7 @@ func (wx *WxChat) triggerInitEvent(me Contact) {
 }
 
 // 触发通讯录初始化事件
-func (wx *WxChat) triggerContactsInitEvent(contactsCount int) {
+func (wx *WxChat) triggerContactsInitEvent(contactsCount int, report *BatchFetchReport) {
 	listener, isReg := wx.listeners[CONTACTS_INIT_EVENT]
 	if isReg {
 		listener(Event{
@@ -235,6 +267,7 @@ func (wx *WxChat) triggerContactsInitEvent(contactsCount int) {
 			EventType: CONTACTS_INIT_EVENT,
 			Data: ContactsInitEventData{
 				ContactsCount: contactsCount,
+				FetchReport:   report,
 			},
 		})
 	}
@@ -282,6 +315,51 @@ func (wx *WxChat) triggerContactDeleteEvent(userNames []string) {
 	}
 }
 
+// 触发群成员加入事件
+func (wx *WxChat) triggerGroupMemberJoinEvent(group Contact, members []Member) {
+	listener, isReg := wx.listeners[GROUP_MEMBER_JOIN_EVENT]
+	if isReg {
+		listener(Event{
+			Time:      time.Now().Unix(),
+			EventType: GROUP_MEMBER_JOIN_EVENT,
+			Data: GroupMemberEventData{
+				Group:   group,
+				Members: members,
+			},
+		})
+	}
+}
+
+// 触发群成员退出事件
+func (wx *WxChat) triggerGroupMemberLeaveEvent(group Contact, members []Member) {
+	listener, isReg := wx.listeners[GROUP_MEMBER_LEAVE_EVENT]
+	if isReg {
+		listener(Event{
+			Time:      time.Now().Unix(),
+			EventType: GROUP_MEMBER_LEAVE_EVENT,
+			Data: GroupMemberEventData{
+				Group:   group,
+				Members: members,
+			},
+		})
+	}
+}
+
+// 触发群成员改名事件
+func (wx *WxChat) triggerGroupMemberRenameEvent(group Contact, renames []MemberRename) {
+	listener, isReg := wx.listeners[GROUP_MEMBER_RENAME_EVENT]
+	if isReg {
+		listener(Event{
+			Time:      time.Now().Unix(),
+			EventType: GROUP_MEMBER_RENAME_EVENT,
+			Data: GroupMemberRenameEventData{
+				Group:   group,
+				Renames: renames,
+			},
+		})
+	}
+}
+
 // 触发消息事件
 func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 
@@ -289,13 +367,16 @@ func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 	isGroupMessage := false
 	isSendByMySelf := false
 	isAtMe := false
+	atUserNames := []string{}
 	mediaUrl := ""
 	content := msg["Content"].(string)
 	fromUserName := msg["FromUserName"].(string)
 	senderUserInfo := SenderUserInfo{}
 	senderUserId := ""
+	senderStableId := ""
 	toUserName := msg["ToUserName"].(string)
 	recommendInfo := map[string]interface{}{}
+	var friendRequest *FriendRequest
 	locationInfo := LocationInfo{}
 	senderUserName := fromUserName
 
@@ -312,6 +393,7 @@ func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 
 	msgType := msg["MsgType"].(float64)
 	mid := msg["MsgId"].(string)
+	createTime, _ := msg["CreateTime"].(float64)
 
 	path := ""
 	switch msgType {
@@ -342,6 +424,7 @@ func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 		{
 			messageType = FriendReqMessage
 			recommendInfo, _ = msg["RecommendInfo"].(map[string]interface{})
+			friendRequest = newFriendRequest(wx, recommendInfo)
 		}
 	case 42:
 		{
@@ -368,54 +451,61 @@ func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 		}
 	}
 
-	if isGroupMessage {
-		atMe := "@"
-		if len(wx.me.DisplayName) > 0 {
-			atMe += wx.me.DisplayName
-		} else {
-			atMe += wx.me.NickName
-		}
-		isAtMe = strings.Contains(content, atMe) // 标识是否是@我
-
-		infos := strings.Split(content, ":<br/>")
-		if len(infos) != 2 {
-			return
-		}
+	// 撤回通知另外存档, 用于导出聊天记录时标记被撤回的消息; 事件不变
+	revokedMsgId := ""
+	if msgType == 10002 {
+		var notice string
+		revokedMsgId, notice = parseRevokeMsg(content)
+		wx.archiveRevoke(msg, groupUserName, revokedMsgId, notice)
+	}
 
-		content = infos[1]
-		if isAtMe && infos[0] == wx.me.UserName {
+	if isGroupMessage {
+		if fromUserName == wx.me.UserName {
+			// 自己从其他设备发出的群消息, 内容不带发送人前缀
 			isSendByMySelf = true
-		}
-
-		contact := &Member{}
-		for {
-			fromGroup, found := wx.contacts[fromUserName]
-			if found {
-				contact, found = fromGroup.MemberMap[infos[0]] // 根据content中UserName(消息发布人)找到详细数据
-				if found {
-					break
-				}
+			senderUserName = wx.me.UserName
+			senderUserInfo = SenderUserInfo{
+				UserName:   wx.me.UserName,
+				NickName:   wx.me.NickName,
+				RemarkName: "mySelf",
 			}
-
-			err := wx.updateContact([]string{fromUserName})
-			if err != nil {
+		} else {
+			infos := strings.SplitN(content, ":<br/>", 2)
+			if len(infos) != 2 {
 				return
 			}
 
-			contact, found = wx.contacts[fromUserName].MemberMap[infos[0]]
+			content = infos[1]
+			isSendByMySelf = infos[0] == wx.me.UserName
+
+			// 根据content中UserName(消息发布人)找到详细数据
+			contact, found := wx.contacts.GetMember(groupUserName, infos[0])
 			if !found {
-				return
+				err := wx.updateContact([]string{groupUserName})
+				if err != nil {
+					return
+				}
+
+				contact, found = wx.contacts.GetMember(groupUserName, infos[0])
+				if !found {
+					return
+				}
+			}
+			senderUserName = infos[0]
+			senderStableId = wx.memberStableId(groupUserName, contact)
+			senderUserInfo = SenderUserInfo{
+				UserName:   infos[0],
+				NickName:   contact.NickName,
+				RemarkName: contact.DisplayName,
 			}
 		}
 
-		if nil == contact {
-			return
-		}
-		senderUserName = infos[0]
-		senderUserInfo = SenderUserInfo{
-			UserName:   infos[0],
-			NickName:   contact.NickName,
-			RemarkName: contact.DisplayName,
+		msgSource, _ := msg["MsgSource"].(string)
+		atUserNames = wx.parseAtUserNames(groupUserName, senderUserName, content, msgSource)
+		for _, userName := range atUserNames {
+			if userName == wx.me.UserName || userName == MentionAll {
+				isAtMe = true // 标识是否是@我
+			}
 		}
 	} else {
 
@@ -433,7 +523,7 @@ func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 				RemarkName: "",
 			}
 
-			senderUser, found := wx.contacts[senderUserName]
+			senderUser, found := wx.contacts.Get(senderUserName)
 
 			if found {
 				senderUserInfo.NickName = senderUser.NickName
@@ -442,49 +532,221 @@ func (wx *WxChat) triggerMessageEvent(msg map[string]interface{}) {
 		}
 	}
 
+	// 群消息的发送人前缀和@成员都按原始内容解析, 之后再解码
+	rawContent := content
+	// 文件、链接等App消息和撤回通知的内容是XML, 不解码
+	if messageType == TextMessage && msgType != 49 && msgType != 10002 {
+		content = utils.DecodeContent(content)
+	}
+
 	fromUserInfo := wx.me
 	if !isSendByMySelf {
-		fromUserInfoTemp, found := wx.contacts[fromUserName]
+		fromUserInfoTemp, found := wx.contacts.Get(fromUserName)
 		if found {
-			fromUserInfo = *fromUserInfoTemp
+			fromUserInfo = fromUserInfoTemp
 		}
 	}
 
 	toUserInfo := wx.me
 	if toUserName != wx.me.UserName {
-		toUserInfoTemp, found := wx.contacts[toUserName]
+		toUserInfoTemp, found := wx.contacts.Get(toUserName)
 		if found {
-			toUserInfo = *toUserInfoTemp
+			toUserInfo = toUserInfoTemp
 		}
 	}
 
 	senderUserId = utils.UserNameToId(senderUserName)
+	if len(senderStableId) == 0 {
+		senderStableId = wx.StableId(senderUserName)
+	}
 
 	event := Event{
 		Time:      time.Now().Unix(),
 		EventType: MESSAGE_EVENT,
 		Data: MessageEventData{
+			MsgId:          mid,
+			CreateTime:     int64(createTime),
 			MessageType:    messageType,
 			IsGroupMessage: isGroupMessage,
 			IsSendByMySelf: isSendByMySelf,
 			IsAtMe:         isAtMe,
+			AtUserNames:    atUserNames,
 			MediaUrl:       mediaUrl,
 			Content:        content,
+			RawContent:     rawContent,
 			FromUserName:   fromUserName,
 			FromUserInfo:   fromUserInfo,
 			SenderUserInfo: senderUserInfo,
 			SenderUserId:   senderUserId,
+			SenderStableId: senderStableId,
 			ToUserName:     toUserName,
 			ToUserInfo:     toUserInfo,
 			RecommendInfo:  recommendInfo,
+			FriendRequest:  friendRequest,
 			LocationInfo:   locationInfo,
+			RevokedMsgId:   revokedMsgId,
 			OriginalMsg:    msg,
 		},
 	}
 
-	wx.logger.Notice("Get Message. SenderNickName=[" + senderUserInfo.NickName + "], Content=[" + content + "]")
+	wx.log(moduleMessage).Noticew("Get Message.",
+		"msgId", mid,
+		"msgType", msgType,
+		"sender", senderUserInfo.NickName,
+		"senderId", senderStableId,
+		"group", groupUserName,
+		"content", content,
+	)
+	wx.archiveMessage(event.Data.(MessageEventData))
+
+	if friendRequest != nil {
+		go wx.autoAcceptFriend(friendRequest)
+	}
+
 	listener, isReg := wx.listeners[MESSAGE_EVENT]
 	if isReg {
 		listener(event)
 	}
 }
+
+var atUserListReg = regexp.MustCompile(`(?s)<atuserlist>(?:<!\[CDATA\[)?(.*?)(?:\]\]>)?</atuserlist>`)
+
+// 解析群消息中被@的成员, 包括MsgSource中的atuserlist和内容中的@群昵称
+// 内容中的@所有人只有群主发送时有效, 其他成员只是输入了这段文字
+func (wx *WxChat) parseAtUserNames(groupUserName string, senderUserName string, content string, msgSource string) []string {
+	atUserNames := []string{}
+	added := map[string]bool{}
+	add := func(userName string) {
+		if !added[userName] {
+			added[userName] = true
+			atUserNames = append(atUserNames, userName)
+		}
+	}
+
+	group, found := wx.contacts.Get(groupUserName)
+	if !found {
+		return atUserNames
+	}
+
+	atUserList := atUserListReg.FindStringSubmatch(html.UnescapeString(msgSource))
+	if len(atUserList) == 2 {
+		for _, userName := range strings.Split(atUserList[1], ",") {
+			userName = strings.TrimSpace(userName)
+			if "notify@all" == userName {
+				add(MentionAll)
+			} else if _, found := group.MemberMap[userName]; found {
+				add(userName)
+			}
+		}
+	}
+
+	if !strings.Contains(content, "@") {
+		return atUserNames
+	}
+
+	// @时客户端插入的是群昵称, 未设置群昵称时才是微信昵称
+	for userName, member := range group.MemberMap {
+		name := member.DisplayName
+		if len(name) == 0 {
+			name = member.NickName
+		}
+		if len(name) == 0 && userName == wx.me.UserName {
+			name = wx.me.NickName
+		}
+		if len(name) > 0 && isMentioned(content, name) {
+			add(userName)
+		}
+	}
+
+	if isMentioned(content, "所有人") && wx.isGroupOwner(group, senderUserName) {
+		add(MentionAll)
+	}
+
+	return atUserNames
+}
+
+// 是否是群主, 自己以IsOwner判断, 其他成员以群的OwnerUin判断
+func (wx *WxChat) isGroupOwner(group Contact, userName string) bool {
+	if userName == wx.me.UserName {
+		return group.IsOwner != 0
+	}
+	member, found := group.MemberMap[userName]
+	return found && group.OwnerUin != 0 && member.Uin == group.OwnerUin
+}
+
+// 判断内容中是否@了name, @昵称后需为空格或者结尾
+func isMentioned(content string, name string) bool {
+	at := "@" + name
+	for {
+		index := strings.Index(content, at)
+		if index == -1 {
+			return false
+		}
+		content = content[index+len(at):]
+		if len(content) == 0 || strings.HasPrefix(content, "\u2005") || strings.HasPrefix(content, " ") {
+			return true
+		}
+	}
+}
+
+// 是否是文件、链接等App消息, 这类消息的MessageType为TextMessage
+func isAppMsg(data MessageEventData) bool {
+	msgType, _ := data.OriginalMsg["MsgType"].(float64)
+	return msgType == 49
+}
+
+// 文本消息的纯文本内容, 兼容解码前存档的消息
+func plainContent(data MessageEventData) string {
+	if data.MessageType == TextMessage && len(data.RawContent) == 0 && !isAppMsg(data) {
+		return utils.DecodeContent(data.Content)
+	}
+	return data.Content
+}
+
+var (
+	revokeMsgIdReg   = regexp.MustCompile(`<msgid>(\d+)</msgid>`)
+	revokeReplaceReg = regexp.MustCompile(`<replacemsg><!\[CDATA\[(.*?)\]\]></replacemsg>`)
+)
+
+// 存档撤回通知, Content为提示文字
+func (wx *WxChat) archiveRevoke(msg map[string]interface{}, groupUserName string, revokedMsgId string, notice string) {
+	if archive, _ := wx.currentArchive(); archive == nil || len(revokedMsgId) == 0 {
+		return
+	}
+
+	fromUserName := msg["FromUserName"].(string)
+	toUserName := msg["ToUserName"].(string)
+	fromUserInfo, _ := wx.contacts.Get(fromUserName)
+	toUserInfo, _ := wx.contacts.Get(toUserName)
+	createTime, _ := msg["CreateTime"].(float64)
+	msgId, _ := msg["MsgId"].(string)
+
+	wx.archiveMessage(MessageEventData{
+		MsgId:          msgId,
+		CreateTime:     int64(createTime),
+		MessageType:    TextMessage,
+		IsGroupMessage: len(groupUserName) > 0,
+		IsSendByMySelf: fromUserName == wx.me.UserName,
+		Content:        notice,
+		RawContent:     msg["Content"].(string),
+		FromUserName:   fromUserName,
+		FromUserInfo:   fromUserInfo,
+		ToUserName:     toUserName,
+		ToUserInfo:     toUserInfo,
+		RevokedMsgId:   revokedMsgId,
+		OriginalMsg:    msg,
+	})
+}
+
+// 解析撤回通知, 返回被撤回的消息ID和提示文字
+func parseRevokeMsg(content string) (string, string) {
+	sysmsg := html.UnescapeString(content)
+	revokedMsgId := ""
+	if match := revokeMsgIdReg.FindStringSubmatch(sysmsg); len(match) == 2 {
+		revokedMsgId = match[1]
+	}
+	if match := revokeReplaceReg.FindStringSubmatch(sysmsg); len(match) == 2 {
+		content = match[1]
+	}
+	return revokedMsgId, content
+}
@@ -0,0 +1,170 @@
+package wxchat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"wxchat/utils"
+)
+
+// 转发多个接收人时每次发送的间隔, 实际间隔会再加上随机抖动
+var ForwardInterval = time.Second * 2
+
+var (
+	emoticonMd5Reg = regexp.MustCompile(`md5\s?=\s?"([0-9a-fA-F]+)"`)
+	attachIdReg    = regexp.MustCompile(`(?s)<attachid>.*?</attachid>`)
+	md5Reg         = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+)
+
+// 发送表情消息, mediaIdOrMd5为上传得到的MediaId或者表情的md5
+func (wx *WxChat) SendEmoticon(to string, mediaIdOrMd5 string) error {
+	sendEmoticonApi := strings.Replace(wxChatApi["sendEmoticonApi"], "{host}", wx.host, 1)
+	sendEmoticonApi = strings.Replace(sendEmoticonApi, "{pass_ticket}", wx.passTicket, 1)
+	msgId := utils.GetUnixMsTime() + strconv.Itoa(rand.Intn(10000))
+	msg := map[string]interface{}{
+		"Type":         47,
+		"EmojiFlag":    2,
+		"FromUserName": wx.me.UserName,
+		"ToUserName":   to,
+		"LocalID":      msgId,
+		"ClientMsgId":  msgId,
+	}
+
+	if md5Reg.MatchString(mediaIdOrMd5) {
+		msg["EMoticonMd5"] = mediaIdOrMd5
+	} else {
+		msg["MediaId"] = mediaIdOrMd5
+	}
+
+	err := wx.postMsg(sendEmoticonApi, msg, 0)
+	if err != nil {
+		wx.log(moduleMessage).Errorw("Send Emoticon Error.", "msgId", msgId, "to", to)
+		return err
+	}
+
+	return nil
+}
+
+// 转发收到的消息, 图片/视频/文件复用原消息的MediaId或内容xml, 无需重新上传
+func (wx *WxChat) Forward(data MessageEventData, to ...string) error {
+	failed := []string{}
+	for i, toUserName := range to {
+		if i > 0 {
+			time.Sleep(ForwardInterval + time.Duration(rand.Int63n(int64(time.Second))))
+		}
+
+		err := wx.forward(data, toUserName)
+		if err != nil {
+			wx.log(moduleMessage).Errorw("Forward Msg Error.", "msgId", data.OriginalMsg["MsgId"], "to", toUserName, "err", err)
+			failed = append(failed, toUserName)
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New("Forward Msg Error. [to]:" + strings.Join(failed, ","))
+	}
+
+	return nil
+}
+
+// 转发消息给单个接收人
+func (wx *WxChat) forward(data MessageEventData, to string) error {
+	msgType, _ := data.OriginalMsg["MsgType"].(float64)
+	mediaId, _ := data.OriginalMsg["MediaId"].(string)
+	rawContent := data.RawContent
+	if len(rawContent) == 0 {
+		rawContent = data.Content
+	}
+	content := strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(rawContent)
+	if msgType == 1 {
+		content = utils.EncodeContent(plainContent(data))
+	}
+
+	msgId := utils.GetUnixMsTime() + strconv.Itoa(rand.Intn(10000))
+	msg := map[string]interface{}{
+		"Type":         int(msgType),
+		"MediaId":      "",
+		"Content":      content,
+		"FromUserName": wx.me.UserName,
+		"ToUserName":   to,
+		"LocalID":      msgId,
+		"ClientMsgId":  msgId,
+	}
+
+	api := ""
+	switch msgType {
+	case 1:
+		api = "sendMsgApi"
+	case 3:
+		api = "sendImgMsgApi"
+		msg["MediaId"] = mediaId
+	case 47:
+		md5 := emoticonMd5Reg.FindStringSubmatch(content)
+		if len(md5) != 2 {
+			return errors.New("Emoticon md5 not found")
+		}
+		return wx.SendEmoticon(to, md5[1])
+	case 43, 62:
+		api = "sendVideoMsgApi"
+		msg["Type"] = 43
+		msg["MediaId"] = mediaId
+	case 49:
+		appMsgType, _ := data.OriginalMsg["AppMsgType"].(float64)
+		api = "sendAppMsgApi"
+		msg["Type"] = int(appMsgType)
+		msg["MediaId"] = mediaId
+		if len(mediaId) > 0 {
+			msg["Content"] = attachIdReg.ReplaceAllString(content, "<attachid>"+mediaId+"</attachid>")
+		}
+	default:
+		return fmt.Errorf("Forward MsgType %v not supported", msgType)
+	}
+
+	forwardApi := strings.Replace(wxChatApi[api], "{host}", wx.host, 1)
+	forwardApi = strings.Replace(forwardApi, "{pass_ticket}", wx.passTicket, 1)
+
+	return wx.postMsg(forwardApi, msg, 2)
+}
+
+// 发送消息请求并检查返回结果
+func (wx *WxChat) postMsg(api string, msg map[string]interface{}, scene int) error {
+	buffer := new(bytes.Buffer)
+	enc := json.NewEncoder(buffer)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(map[string]interface{}{
+		"BaseRequest": wx.baseRequest,
+		"Msg":         msg,
+		"Scene":       scene,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	respContent, err := wx.httpClient.post(api, buffer.Bytes(), time.Second*5, &httpHeader{
+		ContentType: "application/json;charset=utf-8",
+		Host:        wx.host,
+		Referer:     "https://" + wx.host + "/?&lang=zh_CN",
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp sendMsgResponse
+	err = json.Unmarshal([]byte(respContent), &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.BaseResponse == nil || resp.BaseResponse.Ret != 0 {
+		return fmt.Errorf("Send Msg Error. [msgId]:%v", msg["LocalID"])
+	}
+
+	return nil
+}
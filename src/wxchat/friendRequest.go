@@ -0,0 +1,188 @@
+package wxchat
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// 好友请求
+type FriendRequest struct {
+	UserName  string
+	NickName  string
+	Alias     string
+	Province  string
+	City      string
+	Sex       float64
+	Signature string
+	Content   string // 验证消息
+	Ticket    string
+	Scene     float64 // 添加来源
+	wx        *WxChat
+}
+
+// 自动通过好友请求的策略
+// 验证消息包含任一关键词, 或者昵称/微信号在白名单中时通过; 两者都为空时不通过任何请求, 除非设置AcceptAll
+type FriendAcceptPolicy struct {
+	AcceptAll  bool // 通过所有请求, 忽略Keywords和Allowlist
+	Keywords   []string
+	Allowlist  []string
+	DailyQuota int    // 每天最多自动通过的数量, 0不限
+	Remark     string // 备注名模板(text/template, 以FriendRequest渲染), 为空时不设置
+	Welcome    string // 欢迎消息模板, 为空时不发送
+}
+
+// 自动通过的状态
+type friendAcceptor struct {
+	mn     sync.Mutex
+	policy *FriendAcceptPolicy
+	day    string
+	count  int
+}
+
+func newFriendRequest(wx *WxChat, recommendInfo map[string]interface{}) *FriendRequest {
+	req := &FriendRequest{wx: wx}
+	req.UserName, _ = recommendInfo["UserName"].(string)
+	req.NickName, _ = recommendInfo["NickName"].(string)
+	req.Alias, _ = recommendInfo["Alias"].(string)
+	req.Province, _ = recommendInfo["Province"].(string)
+	req.City, _ = recommendInfo["City"].(string)
+	req.Sex, _ = recommendInfo["Sex"].(float64)
+	req.Signature, _ = recommendInfo["Signature"].(string)
+	req.Content, _ = recommendInfo["Content"].(string)
+	req.Ticket, _ = recommendInfo["Ticket"].(string)
+	req.Scene, _ = recommendInfo["Scene"].(float64)
+	return req
+}
+
+// 通过好友请求, greeting不为空时通过后发送给对方
+func (req *FriendRequest) Accept(greeting string) error {
+	scene := int(req.Scene)
+	if scene == 0 {
+		scene = defaultVerifyScene
+	}
+	err := req.wx.verifyUser(3, req.UserName, req.Ticket, "", scene)
+	if err != nil {
+		return err
+	}
+
+	req.wx.log(moduleContacts).Noticew("Friend Request Accepted.", "userName", req.UserName, "nickName", req.NickName)
+
+	if len(greeting) > 0 {
+		req.wx.QueueTextMsg(greeting, req.UserName, PRIORITY_NORMAL)
+	}
+	return nil
+}
+
+// 设置自动通过好友请求的策略, 为nil时关闭
+func (wx *WxChat) SetFriendAcceptPolicy(policy *FriendAcceptPolicy) {
+	wx.friendAcceptor.mn.Lock()
+	defer wx.friendAcceptor.mn.Unlock()
+	wx.friendAcceptor.policy = policy
+}
+
+// 根据策略自动处理好友请求
+func (wx *WxChat) autoAcceptFriend(req *FriendRequest) {
+	policy, ok := wx.friendAcceptor.take(req)
+	if !ok {
+		return
+	}
+
+	remark, err := renderFriendTemplate(policy.Remark, req)
+	if err != nil {
+		wx.log(moduleContacts).Errorw("Friend Remark Template Error.", "err", err)
+	}
+	welcome, err := renderFriendTemplate(policy.Welcome, req)
+	if err != nil {
+		wx.log(moduleContacts).Errorw("Friend Welcome Template Error.", "err", err)
+	}
+
+	err = req.Accept(welcome)
+	if err != nil {
+		wx.friendAcceptor.release()
+		wx.log(moduleContacts).Errorw("Auto Accept Friend Error.", "userName", req.UserName, "nickName", req.NickName, "err", err)
+		return
+	}
+
+	if len(remark) > 0 {
+		// 新好友还不在通讯录中, 先获取再设置备注名
+		err = wx.updateContact([]string{req.UserName})
+		if err != nil {
+			wx.log(moduleContacts).Warnw("Fetch New Friend Error.", "userName", req.UserName, "err", err)
+		}
+		err = wx.SetRemarkName(req.UserName, remark)
+		if err != nil {
+			wx.log(moduleContacts).Errorw("Set New Friend Remark Error.", "userName", req.UserName, "remark", remark, "err", err)
+		}
+	}
+}
+
+// 检查策略和当天配额, 满足时占用一个配额, 通过失败时需调用release归还
+func (acceptor *friendAcceptor) take(req *FriendRequest) (*FriendAcceptPolicy, bool) {
+	acceptor.mn.Lock()
+	defer acceptor.mn.Unlock()
+
+	policy := acceptor.policy
+	if policy == nil || !policy.match(req) {
+		return nil, false
+	}
+
+	today := time.Now().Format("2006-01-02")
+	if acceptor.day != today {
+		acceptor.day = today
+		acceptor.count = 0
+	}
+	if policy.DailyQuota > 0 && acceptor.count >= policy.DailyQuota {
+		return nil, false
+	}
+	acceptor.count++
+
+	return policy, true
+}
+
+// 归还take占用的配额, 跨天后不需要归还
+func (acceptor *friendAcceptor) release() {
+	acceptor.mn.Lock()
+	defer acceptor.mn.Unlock()
+
+	if acceptor.day == time.Now().Format("2006-01-02") && acceptor.count > 0 {
+		acceptor.count--
+	}
+}
+
+func (policy *FriendAcceptPolicy) match(req *FriendRequest) bool {
+	if policy.AcceptAll {
+		return true
+	}
+
+	for _, keyword := range policy.Keywords {
+		if len(keyword) > 0 && strings.Contains(req.Content, keyword) {
+			return true
+		}
+	}
+	for _, name := range policy.Allowlist {
+		if len(name) > 0 && (name == req.NickName || name == req.Alias) {
+			return true
+		}
+	}
+	return false
+}
+
+func renderFriendTemplate(tmpl string, req *FriendRequest) (string, error) {
+	if len(tmpl) == 0 {
+		return "", nil
+	}
+
+	t, err := template.New("friend").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	buffer := new(bytes.Buffer)
+	err = t.Execute(buffer, req)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
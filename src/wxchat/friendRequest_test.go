@@ -0,0 +1,75 @@
+package wxchat
+
+import "testing"
+
+func TestFriendAcceptorQuotaCountsOnlySuccess(t *testing.T) {
+	acceptor := &friendAcceptor{policy: &FriendAcceptPolicy{Keywords: []string{"合作"}, DailyQuota: 1}}
+
+	if _, ok := acceptor.take(&FriendRequest{Content: "你好"}); ok {
+		t.Fatal("request without keyword accepted")
+	}
+
+	req := &FriendRequest{Content: "谈合作"}
+	if _, ok := acceptor.take(req); !ok {
+		t.Fatal("first request rejected")
+	}
+	// 通过失败, 归还配额
+	acceptor.release()
+	if _, ok := acceptor.take(req); !ok {
+		t.Fatal("quota used by failed accept")
+	}
+	if _, ok := acceptor.take(req); ok {
+		t.Fatal("quota exceeded")
+	}
+}
+
+func TestFriendAcceptPolicyMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy FriendAcceptPolicy
+		req    FriendRequest
+		want   bool
+	}{
+		{"empty policy accepts nothing", FriendAcceptPolicy{}, FriendRequest{Content: "你好"}, false},
+		{"accept all", FriendAcceptPolicy{AcceptAll: true}, FriendRequest{Content: "你好"}, true},
+		{"keyword", FriendAcceptPolicy{Keywords: []string{"合作", "读者"}}, FriendRequest{Content: "我是读者"}, true},
+		{"keyword missing", FriendAcceptPolicy{Keywords: []string{"合作"}}, FriendRequest{Content: "你好"}, false},
+		{"empty keyword ignored", FriendAcceptPolicy{Keywords: []string{""}}, FriendRequest{Content: "你好"}, false},
+		{"allowlist nick name", FriendAcceptPolicy{Allowlist: []string{"张三"}}, FriendRequest{NickName: "张三"}, true},
+		{"allowlist alias", FriendAcceptPolicy{Allowlist: []string{"zhangsan"}}, FriendRequest{NickName: "张三", Alias: "zhangsan"}, true},
+		{"allowlist is exact", FriendAcceptPolicy{Allowlist: []string{"张"}}, FriendRequest{NickName: "张三"}, false},
+		{"keyword or allowlist", FriendAcceptPolicy{Keywords: []string{"合作"}, Allowlist: []string{"张三"}}, FriendRequest{NickName: "张三", Content: "你好"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.match(&tt.req); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderFriendTemplate(t *testing.T) {
+	req := &FriendRequest{NickName: "张三", Alias: "zhangsan", Province: "山东", City: "青岛", Content: "我是读者"}
+
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"{{.NickName}}-{{.City}}", "张三-青岛", false},
+		{"你好{{.NickName}}, 欢迎来自{{.Province}}的朋友", "你好张三, 欢迎来自山东的朋友", false},
+		{"{{.Alias}}({{.Content}})", "zhangsan(我是读者)", false},
+		{"{{.NickName", "", true},
+		{"{{.Unknown}}", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := renderFriendTemplate(tt.tmpl, req)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("renderFriendTemplate(%q) = %q, %v; want %q, err %v", tt.tmpl, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
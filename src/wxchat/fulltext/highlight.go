@@ -0,0 +1,78 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 标记原文中匹配查询的部分, 并截取第一个匹配附近最多maxRunes个字符, maxRunes为0时不截取
+func Highlight(text string, query string, pre string, post string, maxRunes int) string {
+	terms := map[string]bool{}
+	for _, term := range QueryTerms(query) {
+		terms[term] = true
+	}
+
+	// 合并重叠的匹配区间
+	type span struct {
+		start int
+		end   int
+	}
+	spans := []span{}
+	for _, token := range Tokenize(text) {
+		if !terms[token.Term] {
+			continue
+		}
+		if n := len(spans); n > 0 && token.Start <= spans[n-1].end {
+			if token.End > spans[n-1].end {
+				spans[n-1].end = token.End
+			}
+			continue
+		}
+		spans = append(spans, span{start: token.Start, end: token.End})
+	}
+
+	from, to := 0, len(text)
+	if maxRunes > 0 && utf8.RuneCountInString(text) > maxRunes {
+		first := 0
+		if len(spans) > 0 {
+			first = spans[0].start
+		}
+		// 匹配前保留少量上下文
+		from = first
+		for i := 0; i < maxRunes/4 && from > 0; i++ {
+			_, size := utf8.DecodeLastRuneInString(text[:from])
+			from -= size
+		}
+		to = from
+		for i := 0; i < maxRunes && to < len(text); i++ {
+			_, size := utf8.DecodeRuneInString(text[to:])
+			to += size
+		}
+	}
+
+	builder := strings.Builder{}
+	if from > 0 {
+		builder.WriteString("...")
+	}
+	pos := from
+	for _, s := range spans {
+		if s.end <= from || s.start >= to {
+			continue
+		}
+		start, end := s.start, s.end
+		if start < from {
+			start = from
+		}
+		if end > to {
+			end = to
+		}
+		builder.WriteString(text[pos:start])
+		builder.WriteString(pre + text[start:end] + post)
+		pos = end
+	}
+	builder.WriteString(text[pos:to])
+	if to < len(text) {
+		builder.WriteString("...")
+	}
+	return builder.String()
+}
@@ -0,0 +1,31 @@
+package fulltext
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		query    string
+		maxRunes int
+		want     string
+	}{
+		{"no match", "hello world", "foo", 0, "hello world"},
+		{"word ignores case", "Hello World", "world", 0, "Hello [World]"},
+		{"cjk bigram", "我爱北京天安门", "北京", 0, "我爱[北京]天安门"},
+		{"overlapping bigrams merge", "北京天安门", "北京天", 0, "[北京天]安门"},
+		{"multiple matches", "go and Go", "go", 0, "[go] and [Go]"},
+		{"single cjk char", "好的好", "好", 0, "[好]的[好]"},
+		{"short text is not truncated", "我爱北京", "北京", 10, "我爱[北京]"},
+		{"truncate around first match", "aaaa bbbb cccc dddd 北京 eeee ffff", "北京", 8, "...d [北京] eee..."},
+		{"truncate from start", "北京 aaaa bbbb cccc", "北京", 4, "[北京] a..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.text, tt.query, "[", "]", tt.maxRunes); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package fulltext
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// 内存倒排索引, 文档以添加顺序编号
+type Index struct {
+	mn       sync.RWMutex
+	docCount int
+	postings map[string][]posting
+}
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// 查询结果
+type Match struct {
+	Doc   int
+	Score float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string][]posting{},
+	}
+}
+
+// 添加文档, 返回文档编号
+func (index *Index) Add(text string) int {
+	counts := map[string]int{}
+	for _, token := range Tokenize(text) {
+		counts[token.Term]++
+	}
+
+	index.mn.Lock()
+	defer index.mn.Unlock()
+
+	doc := index.docCount
+	index.docCount++
+	for term, tf := range counts {
+		index.postings[term] = append(index.postings[term], posting{doc: doc, tf: tf})
+	}
+	return doc
+}
+
+// 文档数量
+func (index *Index) Len() int {
+	index.mn.RLock()
+	defer index.mn.RUnlock()
+	return index.docCount
+}
+
+// 查询包含所有查询词的文档, 按tf-idf排序, 同分时新文档在前
+func (index *Index) Search(text string) []Match {
+	terms := QueryTerms(text)
+	if len(terms) == 0 {
+		return []Match{}
+	}
+
+	index.mn.RLock()
+	defer index.mn.RUnlock()
+
+	scores := map[int]float64{}
+	for i, term := range terms {
+		list := index.postings[term]
+		if len(list) == 0 {
+			return []Match{}
+		}
+
+		idf := math.Log(1 + float64(index.docCount)/float64(len(list)))
+		next := map[int]float64{}
+		for _, p := range list {
+			score, found := scores[p.doc]
+			if i > 0 && !found {
+				continue
+			}
+			next[p.doc] = score + (1+math.Log(float64(p.tf)))*idf
+		}
+		scores = next
+	}
+
+	matches := make([]Match, 0, len(scores))
+	for doc, score := range scores {
+		matches = append(matches, Match{Doc: doc, Score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Doc > matches[j].Doc
+	})
+	return matches
+}
@@ -0,0 +1,106 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 分词结果, Start和End为在原文中的字节位置
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// 是否按中日韩文字处理
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// 分词: 字母数字连续的部分为一个词(转小写); 中日韩文字按二元切分, 同时保留单字
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+
+	// 中日韩文字的连续片段
+	type char struct {
+		start int
+		end   int
+	}
+	run := []char{}
+	flushRun := func() {
+		for i, c := range run {
+			tokens = append(tokens, Token{Term: text[c.start:c.end], Start: c.start, End: c.end})
+			if i+1 < len(run) {
+				tokens = append(tokens, Token{Term: text[c.start:run[i+1].end], Start: c.start, End: run[i+1].end})
+			}
+		}
+		run = run[:0]
+	}
+
+	wordStart := -1
+	for i, r := range text {
+		size := utf8.RuneLen(r)
+		if size < 0 {
+			size = 1
+		}
+
+		if isCJK(r) {
+			if wordStart >= 0 {
+				tokens = append(tokens, Token{Term: strings.ToLower(text[wordStart:i]), Start: wordStart, End: i})
+				wordStart = -1
+			}
+			run = append(run, char{start: i, end: i + size})
+			continue
+		}
+		flushRun()
+
+		if isWordRune(r) {
+			if wordStart < 0 {
+				wordStart = i
+			}
+		} else if wordStart >= 0 {
+			tokens = append(tokens, Token{Term: strings.ToLower(text[wordStart:i]), Start: wordStart, End: i})
+			wordStart = -1
+		}
+	}
+	flushRun()
+	if wordStart >= 0 {
+		tokens = append(tokens, Token{Term: strings.ToLower(text[wordStart:]), Start: wordStart, End: len(text)})
+	}
+
+	return tokens
+}
+
+// 查询词的分词: 两个字以上的中日韩片段只用二元词, 单字时用单字
+func QueryTerms(text string) []string {
+	tokens := Tokenize(text)
+	terms := []string{}
+	seen := map[string]bool{}
+
+	for i, token := range tokens {
+		r, _ := utf8.DecodeRuneInString(token.Term)
+		single := utf8.RuneCountInString(token.Term) == 1 && isCJK(r)
+		// 后面紧跟以该字开头的二元词时跳过单字
+		if single && i+1 < len(tokens) && tokens[i+1].Start == token.Start && tokens[i+1].End > token.End {
+			continue
+		}
+		// 前一个二元词已经包含该字
+		if single && i > 0 && tokens[i-1].End == token.End && tokens[i-1].Start < token.Start {
+			continue
+		}
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+
+	return terms
+}
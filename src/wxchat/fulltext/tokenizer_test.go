@@ -0,0 +1,45 @@
+package fulltext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Token
+	}{
+		{"", []Token{}},
+		{"Hello, World", []Token{{"hello", 0, 5}, {"world", 7, 12}}},
+		{"北京", []Token{{"北", 0, 3}, {"北京", 0, 6}, {"京", 3, 6}}},
+		{"Hi世界2024", []Token{{"hi", 0, 2}, {"世", 2, 5}, {"世界", 2, 8}, {"界", 5, 8}, {"2024", 8, 12}}},
+		{"好，的", []Token{{"好", 0, 3}, {"的", 6, 9}}},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"好", []string{"好"}},
+		{"北京", []string{"北京"}},
+		{"你好世界", []string{"你好", "好世", "世界"}},
+		{"Go 语言 go", []string{"go", "语言"}},
+		{"好 的", []string{"好", "的"}},
+	}
+
+	for _, tt := range tests {
+		if got := QueryTerms(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryTerms(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package wxchat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"wxchat/utils"
+)
+
+var ErrNotGroupOwner = errors.New("Not Group Owner")
+
+// 需要群主权限的操作
+type GroupPermissionError struct {
+	Op     string
+	Group  string
+	Ret    int // 服务端拒绝时的返回值, 本地检查时为0
+	ErrMsg string
+}
+
+func (e *GroupPermissionError) Error() string {
+	return fmt.Sprintf("Not Group Owner. [op]:%s, [group]:%s", e.Op, e.Group)
+}
+
+func (e *GroupPermissionError) Is(target error) bool {
+	return target == ErrNotGroupOwner
+}
+
+// 群操作失败, Ret和ErrMsg为微信返回的结果
+type GroupError struct {
+	Op     string
+	Group  string
+	Ret    int
+	ErrMsg string
+}
+
+func (e *GroupError) Error() string {
+	return fmt.Sprintf("Group Op Error. [op]:%s, [group]:%s, [ret]:%d, [msg]:%s", e.Op, e.Group, e.Ret, e.ErrMsg)
+}
+
+// 服务端表示没有权限的Ret, 例如非群主移出成员
+var groupPermissionRets = map[int]bool{
+	-2: true,
+}
+
+// 根据返回结果生成错误, 没有权限时返回GroupPermissionError
+func newGroupError(op string, group string, resp *baseResponse) error {
+	groupErr := &GroupError{Op: op, Group: group}
+	if resp != nil {
+		groupErr.Ret = resp.Ret
+		groupErr.ErrMsg = resp.ErrMsg
+	}
+	if resp != nil && (groupPermissionRets[resp.Ret] || strings.Contains(resp.ErrMsg, "权限")) {
+		return &GroupPermissionError{Op: op, Group: group, Ret: groupErr.Ret, ErrMsg: groupErr.ErrMsg}
+	}
+	return groupErr
+}
+
+type createChatRoomResponse struct {
+	Response
+	Topic        string
+	ChatRoomName string
+	MemberCount  float64
+	MemberList   []*Member
+}
+
+type updateChatRoomResponse struct {
+	Response
+	MemberCount float64
+	MemberList  []*Member
+}
+
+// 创建群聊, members为好友的UserName
+func (wx *WxChat) CreateGroup(topic string, members []string) (Contact, error) {
+	createChatRoomApi := strings.Replace(wxChatApi["createChatRoomApi"], "{host}", wx.host, 1)
+	createChatRoomApi = strings.Replace(createChatRoomApi, "{r}", utils.GetUnixMsTime(), 1)
+	createChatRoomApi = strings.Replace(createChatRoomApi, "{pass_ticket}", wx.passTicket, 1)
+
+	memberList := []map[string]string{}
+	for _, userName := range members {
+		memberList = append(memberList, map[string]string{"UserName": userName})
+	}
+
+	var resp createChatRoomResponse
+	err := wx.postChatRoom(createChatRoomApi, map[string]interface{}{
+		"BaseRequest": wx.baseRequest,
+		"MemberCount": len(memberList),
+		"MemberList":  memberList,
+		"Topic":       topic,
+	}, &resp)
+	if err != nil {
+		return Contact{}, err
+	}
+
+	if resp.BaseResponse == nil || resp.BaseResponse.Ret != 0 || len(resp.ChatRoomName) == 0 {
+		// 群还未创建, 没有UserName
+		groupErr := newGroupError("create", "", resp.BaseResponse)
+		wx.log(moduleContacts).Errorw("Group Create Failed.", "topic", topic, "err", groupErr)
+		return Contact{}, groupErr
+	}
+
+	wx.log(moduleContacts).Noticew("Group Create.", "group", resp.ChatRoomName, "topic", topic)
+
+	// 拉取失败时以返回的成员列表保存
+	err = wx.updateContact([]string{resp.ChatRoomName})
+	if err != nil {
+		wx.putGroup(&Contact{
+			UserName:    resp.ChatRoomName,
+			NickName:    resp.Topic,
+			MemberCount: resp.MemberCount,
+			MemberList:  resp.MemberList,
+			IsOwner:     1,
+			Type:        Group,
+		})
+	}
+
+	group, _ := wx.contacts.Get(resp.ChatRoomName)
+	return group, nil
+}
+
+// 直接拉好友进群
+func (wx *WxChat) AddGroupMembers(group string, members []string) error {
+	err := wx.updateChatRoom("addmember", group, map[string]interface{}{
+		"AddMemberList": strings.Join(members, ","),
+	})
+	if err != nil {
+		return err
+	}
+
+	// 新成员的详细信息需要重新拉取, 由putGroup触发群成员加入事件
+	wx.refreshGroup(group)
+	return nil
+}
+
+// 邀请好友进群, 成员较多的群需要邀请
+func (wx *WxChat) InviteGroupMembers(group string, members []string) error {
+	err := wx.updateChatRoom("invitemember", group, map[string]interface{}{
+		"InviteMemberList": strings.Join(members, ","),
+	})
+	if err != nil {
+		return err
+	}
+
+	wx.refreshGroup(group)
+	return nil
+}
+
+// 群操作成功后刷新群信息, 刷新失败不影响操作结果, 之后的同步消息会再次更新
+func (wx *WxChat) refreshGroup(group string) {
+	err := wx.updateContact([]string{group})
+	if err != nil {
+		wx.log(moduleContacts).Warnw("Refresh Group Failed.", "group", group, "err", err)
+	}
+}
+
+// 移出群成员, 需要群主权限
+func (wx *WxChat) RemoveGroupMembers(group string, members []string) error {
+	contact, found := wx.contacts.Get(group)
+	if found && contact.IsOwner == 0 {
+		return &GroupPermissionError{Op: "delmember", Group: group}
+	}
+
+	err := wx.updateChatRoom("delmember", group, map[string]interface{}{
+		"DelMemberList": strings.Join(members, ","),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		wx.refreshGroup(group)
+		return nil
+	}
+
+	removed := map[string]bool{}
+	for _, userName := range members {
+		removed[userName] = true
+	}
+	memberList := []*Member{}
+	for _, member := range contact.MemberList {
+		if !removed[member.UserName] {
+			memberList = append(memberList, member)
+		}
+	}
+	contact.MemberList = memberList
+	contact.MemberCount = float64(len(memberList))
+	wx.putGroup(&contact)
+
+	return nil
+}
+
+// 修改群名称
+func (wx *WxChat) SetGroupTopic(group string, topic string) error {
+	err := wx.updateChatRoom("modtopic", group, map[string]interface{}{
+		"NewTopic": topic,
+	})
+	if err != nil {
+		return err
+	}
+
+	wx.contacts.Update(group, func(contact *Contact) {
+		contact.NickName = topic
+	})
+	wx.saveIdentities()
+
+	return nil
+}
+
+// 修改群信息
+func (wx *WxChat) updateChatRoom(fun string, group string, params map[string]interface{}) error {
+	updateChatRoomApi := strings.Replace(wxChatApi["updateChatRoomApi"], "{host}", wx.host, 1)
+	updateChatRoomApi = strings.Replace(updateChatRoomApi, "{fun}", fun, 1)
+	updateChatRoomApi = strings.Replace(updateChatRoomApi, "{pass_ticket}", wx.passTicket, 1)
+
+	params["BaseRequest"] = wx.baseRequest
+	params["ChatRoomName"] = group
+
+	var resp updateChatRoomResponse
+	err := wx.postChatRoom(updateChatRoomApi, params, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.BaseResponse == nil || resp.BaseResponse.Ret != 0 {
+		groupErr := newGroupError(fun, group, resp.BaseResponse)
+		wx.log(moduleContacts).Errorw("Group Update Failed.", "op", fun, "group", group, "err", groupErr)
+		return groupErr
+	}
+
+	wx.log(moduleContacts).Noticew("Group Update.", "op", fun, "group", group)
+
+	return nil
+}
+
+func (wx *WxChat) postChatRoom(api string, params map[string]interface{}, resp interface{}) error {
+	buffer := new(bytes.Buffer)
+	enc := json.NewEncoder(buffer)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(params)
+	if err != nil {
+		return err
+	}
+
+	respContent, err := wx.httpClient.post(api, buffer.Bytes(), time.Second*5, &httpHeader{
+		ContentType: "application/json;charset=utf-8",
+		Host:        wx.host,
+		Referer:     "https://" + wx.host + "/?&lang=zh_CN",
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(respContent), resp)
+}
@@ -0,0 +1,163 @@
+package wxchat
+
+import (
+	"encoding/json"
+)
+
+// 同步消息中的群成员变更
+type chatRoomMemberModify struct {
+	UserName    string
+	MemberCount float64
+	MemberList  []*Member
+}
+
+// 处理同步消息中的群成员变更
+func (wx *WxChat) chatRoomMemberModify(list []map[string]interface{}) {
+	for _, item := range list {
+		bs, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+
+		var modify chatRoomMemberModify
+		err = json.Unmarshal(bs, &modify)
+		if err != nil || len(modify.UserName) == 0 {
+			continue
+		}
+
+		if !wx.contacts.Has(modify.UserName) {
+			// 未知的群直接拉取完整信息
+			wx.updateContact([]string{modify.UserName})
+			continue
+		}
+
+		wx.log(moduleContacts).Noticew("ChatRoom Member Modify.", "group", modify.UserName, "memberCount", modify.MemberCount)
+		refresh := false
+		wx.swapGroup(modify.UserName, func(group *Contact) *Contact {
+			if group == nil {
+				return nil
+			}
+			group.MemberList, refresh = mergeGroupMembers(group.MemberList, modify)
+			if modify.MemberCount > 0 {
+				group.MemberCount = modify.MemberCount
+			}
+			return group
+		})
+
+		// 增量列表中没有退群的成员, 人数对不上时重新拉取完整的成员列表
+		if refresh {
+			err := wx.updateContact([]string{modify.UserName})
+			if err != nil {
+				wx.log(moduleContacts).Warnw("Refresh Group Members Failed.", "group", modify.UserName, "err", err)
+			}
+		}
+	}
+}
+
+// 合并同步消息中的成员列表; 成员数与列表长度一致时为完整列表, 否则为增量, 按UserName更新或添加.
+// 增量合并后的人数与MemberCount不一致时返回true, 需要重新拉取
+func mergeGroupMembers(members []*Member, modify chatRoomMemberModify) ([]*Member, bool) {
+	if modify.MemberCount > 0 && int(modify.MemberCount) == len(modify.MemberList) {
+		return modify.MemberList, false
+	}
+
+	merged := make([]*Member, 0, len(members)+len(modify.MemberList))
+	index := map[string]int{}
+	for _, member := range members {
+		index[member.UserName] = len(merged)
+		merged = append(merged, member)
+	}
+	for _, member := range modify.MemberList {
+		if i, found := index[member.UserName]; found {
+			merged[i] = member
+			continue
+		}
+		index[member.UserName] = len(merged)
+		merged = append(merged, member)
+	}
+
+	return merged, modify.MemberCount > 0 && int(modify.MemberCount) != len(merged)
+}
+
+// 保存群信息, 与本地已有的成员列表对比并触发群成员变更事件
+func (wx *WxChat) putGroup(group *Contact) {
+	wx.swapGroup(group.UserName, func(old *Contact) *Contact {
+		return group
+	})
+}
+
+// 在存储的锁内替换群信息, 保证对比的旧成员列表就是被替换的那一份, 并发更新时事件不会重复或丢失
+func (wx *WxChat) swapGroup(userName string, build func(old *Contact) *Contact) {
+	old, current, found := wx.contacts.Swap(userName, func(old *Contact) *Contact {
+		group := build(old)
+		if group == nil {
+			return nil
+		}
+		group.MemberMap = map[string]*Member{}
+		for _, member := range group.MemberList {
+			group.MemberMap[member.UserName] = member
+		}
+		return group
+	})
+	wx.saveIdentities()
+
+	// 首次获取成员列表时不触发事件
+	if !found || len(old.MemberMap) == 0 {
+		return
+	}
+
+	joined, left, renamed := diffGroupMembers(old.MemberMap, current.MemberMap)
+	if len(joined) == 0 && len(left) == 0 && len(renamed) == 0 {
+		return
+	}
+
+	// 退群和改名的成员详情已过期
+	stale := []string{}
+	for _, member := range left {
+		stale = append(stale, member.UserName)
+	}
+	for _, rename := range renamed {
+		stale = append(stale, rename.Member.UserName)
+	}
+	wx.contacts.DeleteMemberContacts(userName, stale)
+
+	// 已释放存储的锁, 同步按顺序触发, 处理器看到的事件与同步消息的顺序一致
+	if len(joined) > 0 {
+		wx.triggerGroupMemberJoinEvent(current, joined)
+	}
+	if len(left) > 0 {
+		wx.triggerGroupMemberLeaveEvent(current, left)
+	}
+	if len(renamed) > 0 {
+		wx.triggerGroupMemberRenameEvent(current, renamed)
+	}
+}
+
+// 对比新旧成员列表
+func diffGroupMembers(oldMembers map[string]*Member, newMembers map[string]*Member) (joined []Member, left []Member, renamed []MemberRename) {
+	for userName, member := range newMembers {
+		oldMember, found := oldMembers[userName]
+		if !found {
+			joined = append(joined, *member)
+			continue
+		}
+
+		// 成员列表中的昵称可能为空, 为空时不视为改名
+		nickNameChanged := len(member.NickName) > 0 && member.NickName != oldMember.NickName
+		if nickNameChanged || member.DisplayName != oldMember.DisplayName {
+			renamed = append(renamed, MemberRename{
+				Member:         *member,
+				OldNickName:    oldMember.NickName,
+				OldDisplayName: oldMember.DisplayName,
+			})
+		}
+	}
+
+	for userName, member := range oldMembers {
+		if _, found := newMembers[userName]; !found {
+			left = append(left, *member)
+		}
+	}
+
+	return joined, left, renamed
+}
@@ -0,0 +1,195 @@
+package wxchat
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	logs "wxchat/log"
+)
+
+func memberMap(members ...*Member) map[string]*Member {
+	m := map[string]*Member{}
+	for _, member := range members {
+		m[member.UserName] = member
+	}
+	return m
+}
+
+func memberNames(members []Member) string {
+	names := []string{}
+	for _, member := range members {
+		names = append(names, member.UserName)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestDiffGroupMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     map[string]*Member
+		new     map[string]*Member
+		joined  string
+		left    string
+		renamed string
+	}{
+		{
+			name: "unchanged",
+			old:  memberMap(&Member{UserName: "@a", NickName: "a"}),
+			new:  memberMap(&Member{UserName: "@a", NickName: "a"}),
+		},
+		{
+			name:   "join and leave",
+			old:    memberMap(&Member{UserName: "@a"}, &Member{UserName: "@b"}),
+			new:    memberMap(&Member{UserName: "@a"}, &Member{UserName: "@c"}),
+			joined: "@c",
+			left:   "@b",
+		},
+		{
+			name:    "display name changed",
+			old:     memberMap(&Member{UserName: "@a", NickName: "a", DisplayName: "x"}),
+			new:     memberMap(&Member{UserName: "@a", NickName: "a", DisplayName: "y"}),
+			renamed: "@a",
+		},
+		{
+			name:    "nick name changed",
+			old:     memberMap(&Member{UserName: "@a", NickName: "a"}),
+			new:     memberMap(&Member{UserName: "@a", NickName: "b"}),
+			renamed: "@a",
+		},
+		{
+			name: "empty nick name is not a rename",
+			old:  memberMap(&Member{UserName: "@a", NickName: "a"}),
+			new:  memberMap(&Member{UserName: "@a"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			joined, left, renamed := diffGroupMembers(tt.old, tt.new)
+			renamedMembers := []Member{}
+			for _, rename := range renamed {
+				renamedMembers = append(renamedMembers, rename.Member)
+			}
+			if got := memberNames(joined); got != tt.joined {
+				t.Errorf("joined: got %q, want %q", got, tt.joined)
+			}
+			if got := memberNames(left); got != tt.left {
+				t.Errorf("left: got %q, want %q", got, tt.left)
+			}
+			if got := memberNames(renamedMembers); got != tt.renamed {
+				t.Errorf("renamed: got %q, want %q", got, tt.renamed)
+			}
+		})
+	}
+}
+
+func TestMergeGroupMembers(t *testing.T) {
+	current := []*Member{{UserName: "@a", NickName: "a"}, {UserName: "@b", NickName: "b"}}
+
+	tests := []struct {
+		name    string
+		modify  chatRoomMemberModify
+		members string
+		refresh bool
+	}{
+		{
+			name:    "full list replaces",
+			modify:  chatRoomMemberModify{MemberCount: 1, MemberList: []*Member{{UserName: "@a"}}},
+			members: "@a",
+		},
+		{
+			name:    "delta keeps other members",
+			modify:  chatRoomMemberModify{MemberCount: 3, MemberList: []*Member{{UserName: "@c"}}},
+			members: "@a,@b,@c",
+		},
+		{
+			name:    "delta updates existing member",
+			modify:  chatRoomMemberModify{MemberCount: 2, MemberList: []*Member{{UserName: "@b", DisplayName: "bb"}, {UserName: "@a"}}},
+			members: "@a,@b",
+		},
+		{
+			name:    "delta with unknown leave needs refresh",
+			modify:  chatRoomMemberModify{MemberCount: 2, MemberList: []*Member{{UserName: "@c"}}},
+			members: "@a,@b,@c",
+			refresh: true,
+		},
+		{
+			name:    "missing count is a delta",
+			modify:  chatRoomMemberModify{MemberList: []*Member{{UserName: "@c"}}},
+			members: "@a,@b,@c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, refresh := mergeGroupMembers(current, tt.modify)
+			members := []Member{}
+			for _, member := range merged {
+				members = append(members, *member)
+			}
+			if got := memberNames(members); got != tt.members {
+				t.Errorf("members: got %q, want %q", got, tt.members)
+			}
+			if refresh != tt.refresh {
+				t.Errorf("refresh: got %v, want %v", refresh, tt.refresh)
+			}
+		})
+	}
+}
+
+func TestContactStoreSwapIsAtomic(t *testing.T) {
+	store := NewContactStore()
+	store.Put(&Contact{UserName: "@@g", Type: Group})
+
+	// 并发添加成员, 每次替换看到的旧列表都包含之前的所有修改
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.Swap("@@g", func(old *Contact) *Contact {
+				old.MemberList = append(old.MemberList, &Member{UserName: "@" + string(rune('A'+i))})
+				return old
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	group, _ := store.Get("@@g")
+	if len(group.MemberList) != 50 {
+		t.Fatalf("got %d members, want 50", len(group.MemberList))
+	}
+}
+
+func TestSwapGroupTriggersEventsInOrder(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	events := []EventType{}
+	for _, eventType := range []EventType{GROUP_MEMBER_JOIN_EVENT, GROUP_MEMBER_LEAVE_EVENT, GROUP_MEMBER_RENAME_EVENT} {
+		wx.SetListener(eventType, func(event Event) {
+			events = append(events, event.EventType)
+		})
+	}
+
+	wx.putGroup(&Contact{UserName: "@@g", Type: Group, MemberList: []*Member{
+		{UserName: "@a", NickName: "a"},
+		{UserName: "@b", NickName: "b"},
+	}})
+	if len(events) != 0 {
+		t.Fatalf("first member list should not trigger events, got %v", events)
+	}
+
+	wx.putGroup(&Contact{UserName: "@@g", Type: Group, MemberList: []*Member{
+		{UserName: "@a", NickName: "aa"},
+		{UserName: "@c", NickName: "c"},
+	}})
+
+	// 同步触发, 返回时已按加入、退出、改名的顺序处理完
+	want := []EventType{GROUP_MEMBER_JOIN_EVENT, GROUP_MEMBER_LEAVE_EVENT, GROUP_MEMBER_RENAME_EVENT}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+}
@@ -0,0 +1,120 @@
+package wxchat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewGroupError(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       *baseResponse
+		permission bool
+	}{
+		{name: "no response", resp: nil},
+		{name: "generic failure", resp: &baseResponse{Ret: 1, ErrMsg: "failed"}},
+		{name: "permission ret", resp: &baseResponse{Ret: -2}, permission: true},
+		{name: "permission message", resp: &baseResponse{Ret: 1, ErrMsg: "没有权限"}, permission: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newGroupError("delmember", "@@g", tt.resp)
+			if got := errors.Is(err, ErrNotGroupOwner); got != tt.permission {
+				t.Fatalf("errors.Is(ErrNotGroupOwner): got %v, want %v (%v)", got, tt.permission, err)
+			}
+			var groupErr *GroupError
+			if !tt.permission && !errors.As(err, &groupErr) {
+				t.Fatalf("want *GroupError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestCreateGroupErrorHasNoGroup(t *testing.T) {
+	wx, _ := newStubWxChat(t, func(req stubRequest) string {
+		return `{"BaseResponse":{"Ret":-2,"ErrMsg":""}}`
+	})
+
+	_, err := wx.CreateGroup("话题", []string{"@a", "@b"})
+	var permissionErr *GroupPermissionError
+	if !errors.As(err, &permissionErr) {
+		t.Fatalf("want GroupPermissionError, got %v", err)
+	}
+	if permissionErr.Op != "create" || permissionErr.Group != "" {
+		t.Errorf("got %+v, want op create and empty group", permissionErr)
+	}
+}
+
+func TestRemoveGroupMembersRequiresOwner(t *testing.T) {
+	wx, stub := newStubWxChat(t, nil)
+	wx.contacts.Put(&Contact{UserName: "@@g", Type: Group, IsOwner: 0})
+
+	err := wx.RemoveGroupMembers("@@g", []string{"@a"})
+	if !errors.Is(err, ErrNotGroupOwner) {
+		t.Fatalf("got %v, want ErrNotGroupOwner", err)
+	}
+	if len(stub.Requests()) != 0 {
+		t.Fatalf("local check should not send a request, got %d", len(stub.Requests()))
+	}
+}
+
+func TestAddAndInviteGroupMembersRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		call  func(wx *WxChat) error
+		fun   string
+		field string
+		other string
+	}{
+		{
+			name:  "add",
+			call:  func(wx *WxChat) error { return wx.AddGroupMembers("@@g", []string{"@a", "@b"}) },
+			fun:   "addmember",
+			field: "AddMemberList",
+			other: "InviteMemberList",
+		},
+		{
+			name:  "invite",
+			call:  func(wx *WxChat) error { return wx.InviteGroupMembers("@@g", []string{"@a", "@b"}) },
+			fun:   "invitemember",
+			field: "InviteMemberList",
+			other: "AddMemberList",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 刷新群信息失败不影响结果
+			wx, stub := newStubWxChat(t, func(req stubRequest) string {
+				if strings.HasSuffix(req.Path, "webwxbatchgetcontact") {
+					return `{"BaseResponse":{"Ret":1,"ErrMsg":"fail"}}`
+				}
+				return `{"BaseResponse":{"Ret":0,"ErrMsg":""}}`
+			})
+
+			if err := tt.call(wx); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := stub.Requests()
+			if len(requests) == 0 {
+				t.Fatal("no request sent")
+			}
+			req := requests[0]
+			if got := req.Query.Get("fun"); got != tt.fun {
+				t.Errorf("fun: got %q, want %q", got, tt.fun)
+			}
+			if got := req.Body[tt.field]; got != "@a,@b" {
+				t.Errorf("%s: got %v", tt.field, got)
+			}
+			if _, found := req.Body[tt.other]; found {
+				t.Errorf("%s should not be sent", tt.other)
+			}
+			if got := req.Body["ChatRoomName"]; got != "@@g" {
+				t.Errorf("ChatRoomName: got %v", got)
+			}
+		})
+	}
+}
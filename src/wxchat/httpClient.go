@@ -10,11 +10,15 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
 type httpClient struct {
-	Cookies []*http.Cookie
+	cookieMn  sync.Mutex // 并发请求时保护Cookies
+	Cookies   []*http.Cookie
+	trace     *httpTrace        // 为nil时不跟踪
+	transport http.RoundTripper // 为nil时直接连接, 测试时替换
 }
 
 type httpHeader struct {
@@ -32,34 +36,38 @@ type httpHeader struct {
 
 // 发起get请求
 func (httpClient *httpClient) get(urlStr string, timeout time.Duration, header *httpHeader) (string, error) {
+	body, _, err := httpClient.getWithStatus(urlStr, timeout, header)
+	return string(body), err
+}
+
+// 发起get请求, 同时返回状态码
+func (httpClient *httpClient) getWithStatus(urlStr string, timeout time.Duration, header *httpHeader) ([]byte, int, error) {
 
 	client, err := httpClient.getClient(urlStr, timeout)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 
 	req, err := http.NewRequest("GET", urlStr, nil)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 
 	httpClient.handleHeader(req, header)
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil && err.Error() != "Get /: Cannot Redirect" {
-		return "", err
+		httpClient.traceRequest(req, nil, nil, nil, err, start)
+		return nil, 0, err
 	}
 
-	if len(resp.Cookies()) > 0 {
-		cookies := resp.Cookies()
-		for _, v := range cookies {
-			httpClient.Cookies = append(httpClient.Cookies, v)
-		}
-	}
+	httpClient.addCookies(resp.Cookies())
 
 	body, _ := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
-	return string(body), nil
+	httpClient.traceRequest(req, nil, resp, body, nil, start)
+	return body, resp.StatusCode, nil
 }
 
 // 发起post请求
@@ -77,23 +85,21 @@ func (httpClient *httpClient) post(urlStr string, data []byte, timeout time.Dura
 
 	httpClient.handleHeader(req, header)
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		httpClient.traceRequest(req, data, nil, nil, err, start)
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	if len(resp.Cookies()) > 0 {
-		cookies := resp.Cookies()
-		for _, v := range cookies {
-			httpClient.Cookies = append(httpClient.Cookies, v)
-		}
-	}
+	httpClient.addCookies(resp.Cookies())
 	if err != nil && err.Error() != "Get /: Cannot Redirect" {
 		return "", err
 	}
 
 	body, _ := ioutil.ReadAll(resp.Body)
+	httpClient.traceRequest(req, data, resp, body, nil, start)
 	return string(body), nil
 }
 
@@ -112,23 +118,22 @@ func (httpClient *httpClient) upload(urlStr string, data io.Reader, timeout time
 		return "", err
 	}
 
+	// 上传的文件内容不输出
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		httpClient.traceRequest(req, nil, nil, nil, err, start)
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	if len(resp.Cookies()) > 0 {
-		cookies := resp.Cookies()
-		for _, v := range cookies {
-			httpClient.Cookies = append(httpClient.Cookies, v)
-		}
-	}
+	httpClient.addCookies(resp.Cookies())
 	if err != nil && err.Error() != "Get /: Cannot Redirect" {
 		return "", err
 	}
 
 	body, _ := ioutil.ReadAll(resp.Body)
+	httpClient.traceRequest(req, nil, resp, body, nil, start)
 	return string(body), nil
 }
 
@@ -142,21 +147,26 @@ func (httpClient *httpClient) getClient(urlStr string, timeout time.Duration) (*
 	if err != nil {
 		return nil, err
 	}
-	jar.SetCookies(urlObj, httpClient.Cookies)
+	jar.SetCookies(urlObj, httpClient.getCookies())
+
+	var transport http.RoundTripper = &http.Transport{
+		Dial: func(netw, addr string) (net.Conn, error) {
+			deadline := time.Now().Add(timeout)
+			c, err := net.DialTimeout(netw, addr, timeout) //连接超时时间
+			if err != nil {
+				return nil, err
+			}
+
+			c.SetDeadline(deadline)
+			return c, nil
+		},
+	}
+	if httpClient.transport != nil {
+		transport = httpClient.transport
+	}
 
 	client := &http.Client{
-		Transport: &http.Transport{
-			Dial: func(netw, addr string) (net.Conn, error) {
-				deadline := time.Now().Add(timeout)
-				c, err := net.DialTimeout(netw, addr, timeout) //连接超时时间
-				if err != nil {
-					return nil, err
-				}
-
-				c.SetDeadline(deadline)
-				return c, nil
-			},
-		},
+		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return errors.New("Cannot Redirect")
 		},
@@ -211,8 +221,38 @@ func (httpClient *httpClient) handleHeader(req *http.Request, header *httpHeader
 	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/56.0.2924.87 Safari/537.36")
 }
 
+// 保存响应返回的Cookie
+func (httpClient *httpClient) addCookies(cookies []*http.Cookie) {
+	if len(cookies) == 0 {
+		return
+	}
+	httpClient.cookieMn.Lock()
+	defer httpClient.cookieMn.Unlock()
+	httpClient.Cookies = append(httpClient.Cookies, cookies...)
+}
+
+// Cookie的副本
+func (httpClient *httpClient) getCookies() []*http.Cookie {
+	httpClient.cookieMn.Lock()
+	defer httpClient.cookieMn.Unlock()
+	return append([]*http.Cookie{}, httpClient.Cookies...)
+}
+
+func (httpClient *httpClient) setCookies(cookies []*http.Cookie) {
+	httpClient.cookieMn.Lock()
+	defer httpClient.cookieMn.Unlock()
+	httpClient.Cookies = cookies
+}
+
+// 开启跟踪时输出请求和响应
+func (httpClient *httpClient) traceRequest(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error, start time.Time) {
+	if httpClient.trace != nil {
+		httpClient.trace.log(req, reqBody, resp, respBody, err, start)
+	}
+}
+
 func (httpClient *httpClient) getDataTicket() string {
-	for _, v := range httpClient.Cookies {
+	for _, v := range httpClient.getCookies() {
 		if strings.Contains(v.String(), "webwx_data_ticket") {
 			return strings.Split(v.String(), "=")[1]
 		}
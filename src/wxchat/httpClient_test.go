@@ -0,0 +1,86 @@
+package wxchat
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	logs "wxchat/log"
+)
+
+func TestHttpClientCookiesConcurrent(t *testing.T) {
+	client := &httpClient{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client.addCookies([]*http.Cookie{{Name: "c" + strconv.Itoa(i), Value: "v"}})
+			client.getCookies()
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(client.getCookies()); got != 20 {
+		t.Fatalf("got %d cookies, want 20", got)
+	}
+}
+
+// 记录的请求
+type stubRequest struct {
+	Path  string
+	Query url.Values
+	Body  map[string]interface{}
+}
+
+// 替代网络请求, handler返回响应内容
+type stubTransport struct {
+	mn       sync.Mutex
+	requests []stubRequest
+	handler  func(req stubRequest) string
+}
+
+func (stub *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	record := stubRequest{Path: req.URL.Path, Query: req.URL.Query()}
+	if req.Body != nil {
+		bs, _ := ioutil.ReadAll(req.Body)
+		json.Unmarshal(bs, &record.Body)
+	}
+
+	stub.mn.Lock()
+	stub.requests = append(stub.requests, record)
+	stub.mn.Unlock()
+
+	body := `{"BaseResponse":{"Ret":0,"ErrMsg":""}}`
+	if stub.handler != nil {
+		body = stub.handler(record)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func (stub *stubTransport) Requests() []stubRequest {
+	stub.mn.Lock()
+	defer stub.mn.Unlock()
+	return append([]stubRequest{}, stub.requests...)
+}
+
+// 请求由stubTransport处理的WxChat
+func newStubWxChat(t *testing.T, handler func(req stubRequest) string) (*WxChat, *stubTransport) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.host = "wx.test"
+	wx.me = Contact{UserName: "@me", NickName: "me"}
+	stub := &stubTransport{handler: handler}
+	wx.httpClient.transport = stub
+	return wx, stub
+}
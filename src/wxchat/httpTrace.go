@@ -0,0 +1,120 @@
+package wxchat
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	logs "wxchat/log"
+)
+
+// http请求跟踪, 以debug级别输出到http模块日志
+type httpTrace struct {
+	logger  logs.Interface
+	maxBody int // 输出的请求和响应内容的最大字节数, 0不输出内容
+}
+
+const redactedValue = "***"
+
+// 需要隐藏的参数, 同时匹配url参数、JSON字段和XML标签
+var (
+	redactKeys     = `skey|pass_ticket|sid|wxsid|uin|wxuin|webwx_data_ticket|ticket`
+	redactQueryReg = regexp.MustCompile(`(?i)\b(` + redactKeys + `)=[^&\s"'<]*`)
+	redactJSONReg  = regexp.MustCompile(`(?i)"(` + redactKeys + `)"\s*:\s*("(?:[^"\\]|\\.)*"|-?[\d.]+)`)
+	redactXMLReg   = regexp.MustCompile(`(?i)<(` + redactKeys + `)>[^<]*</`)
+	// url编码后嵌在其他参数中, 如redirect_uri
+	redactEncodedReg = regexp.MustCompile(`(?i)(%3F|%26)(` + redactKeys + `)%3D(?:[^&%\s"'<]|%(?:[013-9a-f][0-9a-f]|2[0-57-9a-f]))*`)
+	redactHeaderSet  = map[string]bool{"Cookie": true, "Set-Cookie": true}
+)
+
+// 开启或关闭http请求跟踪, maxBody为输出内容的最大字节数, 0不输出内容
+func (wx *WxChat) SetHttpTrace(enabled bool, maxBody int) {
+	if !enabled {
+		wx.httpClient.trace = nil
+		return
+	}
+	wx.httpClient.trace = &httpTrace{
+		logger:  wx.log(moduleHttp),
+		maxBody: maxBody,
+	}
+}
+
+// 隐藏敏感参数
+func redactSecrets(s string) string {
+	s = redactQueryReg.ReplaceAllString(s, "${1}="+redactedValue)
+	s = redactEncodedReg.ReplaceAllString(s, "${1}${2}%3D"+redactedValue)
+	s = redactJSONReg.ReplaceAllString(s, `"${1}":"`+redactedValue+`"`)
+	s = redactXMLReg.ReplaceAllString(s, "<${1}>"+redactedValue+"</")
+	return s
+}
+
+// 隐藏Cookie的值, 保留名称
+func redactHeader(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for key, values := range header {
+		if !redactHeaderSet[key] {
+			headers[key] = redactSecrets(strings.Join(values, ", "))
+			continue
+		}
+
+		names := []string{}
+		for _, value := range values {
+			for _, cookie := range strings.Split(value, ";") {
+				name := strings.TrimSpace(strings.SplitN(cookie, "=", 2)[0])
+				if len(name) > 0 {
+					names = append(names, name+"="+redactedValue)
+				}
+			}
+		}
+		headers[key] = strings.Join(names, "; ")
+	}
+	return headers
+}
+
+// 截断内容, 二进制内容只输出长度
+func (trace *httpTrace) body(body []byte, contentType string) string {
+	if trace.maxBody <= 0 || len(body) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "application/octet-stream") || !utf8.Valid(body) {
+		return "<binary " + strconv.Itoa(len(body)) + " bytes>"
+	}
+
+	s := redactSecrets(string(body))
+	if len(s) <= trace.maxBody {
+		return s
+	}
+	cut := trace.maxBody
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "...(" + strconv.Itoa(len(s)) + " bytes)"
+}
+
+func (trace *httpTrace) log(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error, start time.Time) {
+	kv := []interface{}{
+		"method", req.Method,
+		"url", redactSecrets(req.URL.String()),
+		"latency", time.Since(start).String(),
+		"reqHeader", redactHeader(req.Header),
+	}
+	if body := trace.body(reqBody, req.Header.Get("Content-Type")); len(body) > 0 {
+		kv = append(kv, "reqBody", body)
+	}
+
+	if resp != nil {
+		kv = append(kv, "status", resp.StatusCode, "respHeader", redactHeader(resp.Header))
+		if body := trace.body(respBody, resp.Header.Get("Content-Type")); len(body) > 0 {
+			kv = append(kv, "respBody", body)
+		}
+	}
+
+	if err != nil {
+		kv = append(kv, "err", redactSecrets(err.Error()))
+		trace.logger.Warnw("HTTP Trace.", kv...)
+		return
+	}
+	trace.logger.Debugw("HTTP Trace.", kv...)
+}
@@ -0,0 +1,60 @@
+package wxchat
+
+import "testing"
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "url query",
+			in:   "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxsync?sid=abc&skey=@crypt_1&lang=zh_CN&pass_ticket=x%2By",
+			want: "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxsync?sid=***&skey=***&lang=zh_CN&pass_ticket=***",
+		},
+		{
+			name: "keys are case insensitive",
+			in:   "Skey=abc&Uin=123",
+			want: "Skey=***&Uin=***",
+		},
+		{
+			name: "similar names are kept",
+			in:   "uuid=abc&username=@a",
+			want: "uuid=abc&username=@a",
+		},
+		{
+			name: "json string and number",
+			in:   `{"BaseRequest":{"Uin":123456,"Sid":"abc","Skey":"@crypt_\"1","DeviceID":"e1"}}`,
+			want: `{"BaseRequest":{"Uin":"***","Sid":"***","Skey":"***","DeviceID":"e1"}}`,
+		},
+		{
+			name: "json with spaces",
+			in:   `{"skey" : "abc"}`,
+			want: `{"skey":"***"}`,
+		},
+		{
+			name: "xml",
+			in:   "<error><ret>0</ret><skey>@crypt_1</skey><wxsid>abc</wxsid><wxuin>123</wxuin><pass_ticket>x</pass_ticket></error>",
+			want: "<error><ret>0</ret><skey>***</skey><wxsid>***</wxsid><wxuin>***</wxuin><pass_ticket>***</pass_ticket></error>",
+		},
+		{
+			name: "redirect_uri",
+			in:   `window.code=200;window.redirect_uri="https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxnewloginpage?ticket=A1b2&uuid=xyz&lang=zh_CN&scan=1";`,
+			want: `window.code=200;window.redirect_uri="https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxnewloginpage?ticket=***&uuid=xyz&lang=zh_CN&scan=1";`,
+		},
+		{
+			name: "url encoded redirect_uri",
+			in:   "redirect_uri=https%3A%2F%2Fwx.qq.com%2Fcgi-bin%2Fmmwebwx-bin%2Fwebwxnewloginpage%3Fticket%3DA1b2%26uuid%3Dxyz",
+			want: "redirect_uri=https%3A%2F%2Fwx.qq.com%2Fcgi-bin%2Fmmwebwx-bin%2Fwebwxnewloginpage%3Fticket%3D***%26uuid%3Dxyz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactSecrets(tt.in); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package wxchat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+)
+
+var ErrStableIdInUse = errors.New("Stable Id In Use")
+
+// 联系人稳定ID解析
+// UserName每次登录都会变化, 根据Uin、微信号、备注名、昵称生成派生key.
+// 联系人第一次出现时分配ID(群为随机ID), 并把它当前所有的派生key固定到该ID写入映射表;
+// 之后备注名、昵称修改产生的新key也固定到原来的ID, 下次登录时任一key命中即可找回.
+// 多个联系人共用的key标记为不可用, 新ID与已有ID冲突时加序号区分.
+// 完全无法区分的联系人按加载顺序编号, 建议为其设置备注名或在映射表中指定ID.
+type identityResolver struct {
+	mn       sync.Mutex
+	filePath string
+	mapping  map[string]string // 派生key到稳定ID, 为空表示该key不唯一
+	ids      map[string]bool   // 映射表中出现过的ID
+	sessions map[string]string // 本次登录UserName到稳定ID
+	holders  map[string]string // 本次登录稳定ID到UserName
+	dirty    bool
+}
+
+func newIdentityResolver() *identityResolver {
+	return &identityResolver{
+		mapping:  map[string]string{},
+		ids:      map[string]bool{},
+		sessions: map[string]string{},
+		holders:  map[string]string{},
+	}
+}
+
+// 联系人的派生key, 按可靠程度排序
+func identityKeys(contact *Contact) []string {
+	keys := []string{}
+	if contact.Uin != 0 {
+		keys = append(keys, "uin:"+strconv.FormatFloat(contact.Uin, 'f', -1, 64))
+	}
+	if len(contact.Alias) > 0 {
+		keys = append(keys, "alias:"+contact.Alias)
+	}
+	if Group == contact.Type {
+		if len(contact.NickName) > 0 {
+			keys = append(keys, "group:"+contact.NickName)
+		}
+		return keys
+	}
+	if len(contact.RemarkName) > 0 {
+		keys = append(keys, "remark:"+contact.RemarkName)
+	}
+	if len(contact.NickName) > 0 {
+		keys = append(keys, "nick:"+contact.NickName+"|"+contact.Province+"|"+contact.City)
+	}
+	return keys
+}
+
+// 解析稳定ID
+func (resolver *identityResolver) resolve(contact *Contact) string {
+	resolver.mn.Lock()
+	defer resolver.mn.Unlock()
+
+	keys := identityKeys(contact)
+	if id, found := resolver.sessions[contact.UserName]; found {
+		resolver.pin(keys, id)
+		return id
+	}
+
+	for _, key := range keys {
+		id := resolver.mapping[key]
+		if len(id) == 0 {
+			continue
+		}
+		if holder, found := resolver.holders[id]; !found || holder == contact.UserName {
+			resolver.hold(contact.UserName, id)
+			resolver.pin(keys, id)
+			return id
+		}
+		// 已被其他联系人使用, 该key不唯一
+		resolver.mapping[key] = ""
+		resolver.dirty = true
+	}
+
+	base := "user:" + contact.UserName
+	if Group == contact.Type {
+		// 群名称会修改, 也可能重名, 群的ID不包含名称
+		base = newGroupStableId()
+	} else if len(keys) > 0 {
+		base = keys[0]
+	}
+	id := base
+	for i := 2; resolver.ids[id] || len(resolver.holders[id]) > 0; i++ {
+		id = base + "#" + strconv.Itoa(i)
+	}
+
+	resolver.hold(contact.UserName, id)
+	resolver.pin(keys, id)
+	return id
+}
+
+// 随机生成的群ID
+func newGroupStableId() string {
+	bs := make([]byte, 8)
+	rand.Read(bs)
+	return "group:" + hex.EncodeToString(bs)
+}
+
+// 需在持有锁时调用
+func (resolver *identityResolver) hold(userName string, id string) {
+	if old, found := resolver.sessions[userName]; found && resolver.holders[old] == userName {
+		delete(resolver.holders, old)
+	}
+	resolver.sessions[userName] = id
+	resolver.holders[id] = userName
+}
+
+// 把未记录的key固定到ID, 需在持有锁时调用
+func (resolver *identityResolver) pin(keys []string, id string) {
+	for _, key := range keys {
+		if _, found := resolver.mapping[key]; !found {
+			resolver.mapping[key] = id
+			resolver.ids[id] = true
+			resolver.dirty = true
+		}
+	}
+}
+
+// 为联系人指定ID, 覆盖其所有派生key; 该ID已被其他联系人使用时返回ErrStableIdInUse
+func (resolver *identityResolver) assign(contact *Contact, id string) error {
+	resolver.mn.Lock()
+	if holder, found := resolver.holders[id]; found && holder != contact.UserName {
+		resolver.mn.Unlock()
+		return ErrStableIdInUse
+	}
+	resolver.hold(contact.UserName, id)
+	for _, key := range identityKeys(contact) {
+		resolver.mapping[key] = id
+	}
+	resolver.ids[id] = true
+	resolver.dirty = true
+	resolver.mn.Unlock()
+
+	return resolver.save()
+}
+
+// 重新登录后UserName全部变化, 清空本次登录的记录
+func (resolver *identityResolver) resetSession() {
+	resolver.mn.Lock()
+	defer resolver.mn.Unlock()
+	resolver.sessions = map[string]string{}
+	resolver.holders = map[string]string{}
+}
+
+func (resolver *identityResolver) load(filePath string) error {
+	mapping := map[string]string{}
+	bs, err := ioutil.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = json.Unmarshal(bs, &mapping)
+		if err != nil {
+			return err
+		}
+	}
+
+	resolver.mn.Lock()
+	defer resolver.mn.Unlock()
+	resolver.filePath = filePath
+	resolver.mapping = mapping
+	resolver.ids = map[string]bool{}
+	for _, id := range mapping {
+		if len(id) > 0 {
+			resolver.ids[id] = true
+		}
+	}
+	// 按新的映射表重新解析
+	resolver.sessions = map[string]string{}
+	resolver.holders = map[string]string{}
+	resolver.dirty = false
+	return nil
+}
+
+// 有修改时写回映射表文件
+func (resolver *identityResolver) save() error {
+	resolver.mn.Lock()
+	defer resolver.mn.Unlock()
+
+	if !resolver.dirty || len(resolver.filePath) == 0 {
+		return nil
+	}
+	bs, err := json.MarshalIndent(resolver.mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(resolver.filePath, bs, 0600)
+	if err != nil {
+		return err
+	}
+	resolver.dirty = false
+	return nil
+}
+
+// 加载稳定ID映射表(JSON, 派生key到ID), 自动分配的ID和用户修改都会写回该文件
+func (wx *WxChat) SetIdentityMapping(filePath string) error {
+	err := wx.identities.load(filePath)
+	if err != nil {
+		return err
+	}
+	wx.refreshStableIds()
+	return nil
+}
+
+// 为联系人指定稳定ID, 该ID已被其他联系人使用时返回ErrStableIdInUse
+func (wx *WxChat) SetStableId(userName string, stableId string) error {
+	contact, found := wx.contacts.Get(userName)
+	if userName == wx.me.UserName {
+		contact, found = wx.me, true
+	}
+	if !found {
+		return ErrContactNotFound
+	}
+
+	err := wx.identities.assign(&contact, stableId)
+	if err != nil {
+		return err
+	}
+	wx.refreshStableIds()
+	return nil
+}
+
+// 解析自己的稳定ID
+func (wx *WxChat) resolveMyStableId() {
+	wx.me.StableId = wx.identities.resolve(&wx.me)
+	wx.saveIdentities()
+}
+
+func (wx *WxChat) refreshStableIds() {
+	if len(wx.me.UserName) > 0 {
+		wx.resolveMyStableId()
+	}
+	wx.contacts.refreshStableIds()
+	wx.saveIdentities()
+}
+
+// 写回自动固定的ID
+func (wx *WxChat) saveIdentities() {
+	err := wx.identities.save()
+	if err != nil {
+		wx.log(moduleContacts).Warnw("Save Identity Mapping Failed.", "err", err)
+	}
+}
+
+// 获取联系人的稳定ID
+func (wx *WxChat) StableId(userName string) string {
+	if userName == wx.me.UserName {
+		return wx.me.StableId
+	}
+
+	contact, found := wx.contacts.Get(userName)
+	if !found {
+		return ""
+	}
+	return contact.StableId
+}
+
+// 群成员的稳定ID, 是好友时与好友的ID相同
+func (wx *WxChat) memberStableId(groupUserName string, member Member) string {
+	if member.UserName == wx.me.UserName {
+		return wx.me.StableId
+	}
+	if contact, found := wx.contacts.Get(member.UserName); found {
+		return contact.StableId
+	}
+
+	name := member.DisplayName
+	if len(name) == 0 {
+		name = member.NickName
+	}
+	return wx.StableId(groupUserName) + "/" + name
+}
@@ -0,0 +1,97 @@
+package wxchat
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStableIdSurvivesRemarkChangeAndRelogin(t *testing.T) {
+	mappingPath := filepath.Join(t.TempDir(), "identity.json")
+
+	resolver := newIdentityResolver()
+	if err := resolver.load(mappingPath); err != nil {
+		t.Fatal(err)
+	}
+	store := NewContactStore()
+	store.resolver = resolver
+
+	store.Put(&Contact{UserName: "@a", NickName: "张三", RemarkName: "老张", Type: Friend})
+	id, _ := store.Get("@a")
+	store.Update("@a", func(contact *Contact) {
+		contact.RemarkName = "张总"
+	})
+	if got, _ := store.Get("@a"); got.StableId != id.StableId {
+		t.Fatalf("remark change: got %q, want %q", got.StableId, id.StableId)
+	}
+	if err := resolver.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新登录, UserName变化
+	relogin := newIdentityResolver()
+	if err := relogin.load(mappingPath); err != nil {
+		t.Fatal(err)
+	}
+	store = NewContactStore()
+	store.resolver = relogin
+	store.Put(&Contact{UserName: "@b", NickName: "张三", RemarkName: "张总", Type: Friend})
+	if got, _ := store.Get("@b"); got.StableId != id.StableId {
+		t.Fatalf("relogin: got %q, want %q", got.StableId, id.StableId)
+	}
+}
+
+func TestStableIdCollision(t *testing.T) {
+	store := NewContactStore()
+	store.resolver = newIdentityResolver()
+
+	store.Put(&Contact{UserName: "@a", NickName: "同名", Province: "广东", Type: Friend})
+	store.Put(&Contact{UserName: "@b", NickName: "同名", Province: "广东", Type: Friend})
+	store.Put(&Contact{UserName: "@g1", NickName: "同名群", Type: Group})
+	store.Put(&Contact{UserName: "@g2", NickName: "同名群", Type: Group})
+
+	for _, pair := range [][2]string{{"@a", "@b"}, {"@g1", "@g2"}} {
+		first, _ := store.Get(pair[0])
+		second, _ := store.Get(pair[1])
+		if first.StableId == second.StableId {
+			t.Fatalf("%s and %s share stable id %q", pair[0], pair[1], first.StableId)
+		}
+		for _, contact := range []Contact{first, second} {
+			found, ok := store.FindByStableId(contact.StableId)
+			if !ok || found.UserName != contact.UserName {
+				t.Fatalf("FindByStableId(%q) = %q, want %q", contact.StableId, found.UserName, contact.UserName)
+			}
+		}
+	}
+
+	// 删除其中一个不影响另一个的索引
+	store.Delete("@a")
+	b, _ := store.Get("@b")
+	if found, ok := store.FindByStableId(b.StableId); !ok || found.UserName != "@b" {
+		t.Fatalf("FindByStableId after delete = %q, %v", found.UserName, ok)
+	}
+
+	// 重复的key不再用于解析
+	if id := store.resolver.mapping["nick:同名|广东|"]; id != "" {
+		t.Fatalf("ambiguous key still mapped to %q", id)
+	}
+}
+
+func TestGroupStableIdIndependentOfTopic(t *testing.T) {
+	store := NewContactStore()
+	store.resolver = newIdentityResolver()
+
+	store.Put(&Contact{UserName: "@@g", NickName: "项目群", Type: Group})
+	before, _ := store.Get("@@g")
+	if strings.Contains(before.StableId, "项目群") {
+		t.Fatalf("group stable id %q contains topic", before.StableId)
+	}
+
+	store.Update("@@g", func(contact *Contact) {
+		contact.NickName = "新项目群"
+	})
+	after, _ := store.Get("@@g")
+	if after.StableId != before.StableId {
+		t.Fatalf("rename: got %q, want %q", after.StableId, before.StableId)
+	}
+}
@@ -50,11 +50,13 @@ func (wx *WxChat) init() error {
 	}
 
 	if initRes.Response.BaseResponse.Ret != 0 {
-		wx.logger.Error("Init Failed. Res.Ret=" + string(initRes.Response.BaseResponse.Ret))
+		wx.log(moduleLogin).Errorw("Init Failed.", "ret", initRes.Response.BaseResponse.Ret)
 		return errors.New("Init Failed")
 	}
 
 	wx.me = initRes.User
+	wx.identities.resetSession()
+	wx.resolveMyStableId()
 	wx.baseRequest.Skey = initRes.Skey
 	wx.syncKey = initRes.SyncKey
 
@@ -67,14 +67,14 @@ func (wx *WxChat) beginListen() error {
 		hosts[3] = "wx2.qq.com"
 	}
 
-	wx.logger.Info("Being Listen ... ")
+	wx.log(moduleListen).Infow("Being Listen ...", "host", wx.host)
 
 	listenFailedCount := 0
 	for {
 		_, selector, err := wx.listen()
 		if err != nil {
 			listenFailedCount++
-			wx.logger.Error("Listen Failed. Msg:" + err.Error() + fmt.Sprintf(", ListenFailedCount=%d.", listenFailedCount))
+			wx.log(moduleListen).Errorw("Listen Failed.", "err", err, "listenFailedCount", listenFailedCount)
 			wx.triggerListenFailedEvent(listenFailedCount, wx.host)
 		} else {
 			listenFailedCount = 0
@@ -87,7 +87,7 @@ func (wx *WxChat) beginListen() error {
 			for continueFlag != 0 {
 				resp, err := wx.sync()
 				if err != nil {
-					wx.logger.Error("Sync Failed. Msg:" + err.Error())
+					wx.log(moduleListen).Errorw("Sync Failed.", "err", err)
 					continue
 				}
 				continueFlag = resp.ContinueFlag
@@ -102,6 +102,11 @@ func (wx *WxChat) beginListen() error {
 					wx.contactsDelete(resp.DelContactList)
 				}
 
+				// 群成员有修改
+				if resp.ModChatRoomMemberCount > 0 {
+					wx.chatRoomMemberModify(resp.ModChatRoomMemberList)
+				}
+
 				go wx.handleSyncResponse(resp)
 			}
 		}
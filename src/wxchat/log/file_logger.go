@@ -1,113 +1,312 @@
 package logs
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
-	"runtime/debug"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// 指向正在写入的日志文件的软链接
+const currentLogName = "current.log"
+
+// 日志文件切分和保留配置, 目录中只应保存本日志的文件
+type RotateOptions struct {
+	MaxSize    int64         // 单个文件的最大字节数, 0不按大小切分
+	Interval   time.Duration // 按时间切分的间隔, 0不按时间切分
+	MaxBackups int           // 保留的历史文件数, 0不限
+	MaxAge     time.Duration // 历史文件的保留时间, 0不限
+	Compress   bool          // 用gzip压缩历史文件
+}
+
 type RotateFileLogger struct {
 	Logger
+	fileMn             sync.Mutex
+	cleanMn            sync.Mutex // 压缩和清理历史文件
+	cleanWg            sync.WaitGroup
 	file               *os.File                    // 正在操作的文件
+	fileSize           int64                       // 正在操作的文件大小
 	dirPath            string                      // logs文件所在的目录
 	fileNameFormatFunc func(time time.Time) string // 获取文件名格式
-	newFileGapTime     time.Duration               // 创建新log的时间间隔
-	lastFileTime       time.Time                   // 上一次创建文件的时间
+	options            RotateOptions
+	lastFileTime       time.Time // 上一次创建文件的时间
 }
 
+// 以默认配置初始化, 签名与旧版本一致; 创建文件失败时不再panic, 之后每次写入会重试
+// 需要检查创建错误时使用InitWithOptions
 func (fileLogger *RotateFileLogger) Init(dir string) {
+	_ = fileLogger.InitWithOptions(dir, RotateOptions{})
+}
+
+// 按配置初始化, 创建文件失败时返回错误, 之后每次写入会重试
+func (fileLogger *RotateFileLogger) InitWithOptions(dir string, options RotateOptions) error {
 	fileLogger.Logger.Init()
-	fileLogger.mn.Lock()
-	defer fileLogger.mn.Unlock()
+	fileLogger.formatter = &TextFormatter{}
+	fileLogger.out = fileLogger
+
+	fileLogger.fileMn.Lock()
+	defer fileLogger.fileMn.Unlock()
 
 	fileLogger.fileNameFormatFunc = fileLogger.DefaultFileNameFormat
-	fileLogger.logFormatFunc = fileLogger.DefaultLogFormatFunc
-	fileLogger.newFileGapTime = 0
+	fileLogger.options = options
 	fileLogger.lastFileTime = time.Now()
 	fileLogger.dirPath = dir
 
-	f, err := fileLogger.createLogFile(fileLogger.fileNameFormatFunc(fileLogger.lastFileTime))
-	if err != nil {
-		panic(err)
-		return
+	return fileLogger.openFile(fileLogger.lastFileTime, false)
+}
+
+func (fileLogger *RotateFileLogger) DefaultFileNameFormat(fileTime time.Time) string {
+	return fileTime.Format("2006-01-02 15-04-05.000") + ".log"
+}
+
+// 设置按时间切分的间隔
+func (fileLogger *RotateFileLogger) SetNewFileGapTime(gapTime time.Duration) {
+	fileLogger.fileMn.Lock()
+	defer fileLogger.fileMn.Unlock()
+	fileLogger.options.Interval = gapTime
+}
+
+// 设置切分和保留配置
+func (fileLogger *RotateFileLogger) SetRotateOptions(options RotateOptions) {
+	fileLogger.fileMn.Lock()
+	defer fileLogger.fileMn.Unlock()
+	fileLogger.options = options
+}
+
+// 写入当前日志文件, 到达间隔时间或大小上限时先切换到新文件
+func (fileLogger *RotateFileLogger) Write(p []byte) (int, error) {
+	fileLogger.fileMn.Lock()
+	defer fileLogger.fileMn.Unlock()
+
+	now := time.Now()
+	if fileLogger.file == nil {
+		err := fileLogger.openFile(now, false)
+		if err != nil {
+			return 0, err
+		}
+	} else if fileLogger.needRotate(now, int64(len(p))) {
+		err := fileLogger.rotate(now)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	fileLogger.file = f
-	fileLogger.out = f
+	n, err := fileLogger.file.Write(p)
+	fileLogger.fileSize += int64(n)
+	return n, err
+}
+
+// 立即切换到新文件
+func (fileLogger *RotateFileLogger) Rotate() error {
+	fileLogger.fileMn.Lock()
+	defer fileLogger.fileMn.Unlock()
+	return fileLogger.rotate(time.Now())
+}
+
+// 关闭当前文件, 等待历史文件处理完成
+func (fileLogger *RotateFileLogger) Close() error {
+	fileLogger.fileMn.Lock()
+	defer fileLogger.fileMn.Unlock()
+
+	fileLogger.cleanWg.Wait()
+
+	if fileLogger.file == nil {
+		return nil
+	}
+	err := fileLogger.file.Close()
+	fileLogger.file = nil
+	return err
+}
+
+func (fileLogger *RotateFileLogger) needRotate(now time.Time, size int64) bool {
+	options := fileLogger.options
+	if options.Interval > 0 && now.Sub(fileLogger.lastFileTime) >= options.Interval {
+		return true
+	}
+	return options.MaxSize > 0 && fileLogger.fileSize > 0 && fileLogger.fileSize+size > options.MaxSize
 }
 
-func (fileLogger *RotateFileLogger) DefaultFileNameFormat(fileName time.Time) string {
-	layout := "2006-01-01 15-04-05.999"
-	formatTime := fileName.Format(layout)
-	if len(formatTime) != len(layout) {
-		formatTime += ".000"[4-(len(layout)-len(formatTime)) : 4]
+// 需在持有fileMn时调用
+func (fileLogger *RotateFileLogger) rotate(now time.Time) error {
+	fileTime := now
+	if interval := fileLogger.options.Interval; interval > 0 && now.Sub(fileLogger.lastFileTime) >= interval {
+		// 文件时间按间隔对齐
+		rate := int64(now.Sub(fileLogger.lastFileTime)) / int64(interval)
+		fileTime = fileLogger.lastFileTime.Add(interval * time.Duration(rate))
 	}
-	return fmt.Sprintf("%s.log", formatTime)
+
+	oldFile := fileLogger.file
+	err := fileLogger.openFile(fileTime, true)
+	if err != nil {
+		return err
+	}
+	fileLogger.lastFileTime = fileTime
+
+	if oldFile != nil {
+		oldFile.Close()
+		fileLogger.cleanWg.Add(1)
+		go fileLogger.cleanup(oldFile.Name(), fileLogger.file.Name(), fileLogger.options)
+	}
+	return nil
 }
 
-func (fileLogger *RotateFileLogger) createLogFile(fileName string) (f *os.File, err error) {
+// 打开新的日志文件并更新软链接, unique为true时文件名已存在则加序号
+// 需在持有fileMn时调用
+func (fileLogger *RotateFileLogger) openFile(fileTime time.Time, unique bool) error {
 	if len(fileLogger.dirPath) != 0 {
-		fileName = fmt.Sprintf("%s/%s", fileLogger.dirPath, fileName)
-		err = os.MkdirAll(fileLogger.dirPath, 0777)
+		err := os.MkdirAll(fileLogger.dirPath, 0777)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
-	f, err = os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+
+	fileName := filepath.Join(fileLogger.dirPath, fileLogger.fileNameFormatFunc(fileTime))
+	if unique {
+		base := strings.TrimSuffix(fileName, ".log")
+		for i := 1; fileExists(fileName) || fileExists(fileName+".gz"); i++ {
+			fileName = fmt.Sprintf("%s.%d.log", base, i)
+		}
+	}
+
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
-		f = nil
-		return
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	fileLogger.file = f
+	fileLogger.fileSize = info.Size()
+
+	// 软链接失败不影响写日志
+	link := filepath.Join(fileLogger.dirPath, currentLogName)
+	tmpLink := link + ".tmp"
+	os.Remove(tmpLink)
+	if os.Symlink(filepath.Base(fileName), tmpLink) == nil {
+		os.Rename(tmpLink, link)
 	}
-	err = nil
-	return
+	return nil
 }
 
-func (fileLogger *RotateFileLogger) DefaultLogFormatFunc(logType LogType, i interface{}) (string, []interface{}, bool) {
-	format := "%s [%s] %s\n"
-	now := time.Now()
-	gapTime := now.Sub(fileLogger.lastFileTime)
-	if gapTime > fileLogger.newFileGapTime && fileLogger.newFileGapTime > 0 {
-		fileLogger.file.Close()
-		rate := int(int64(gapTime) / int64(fileLogger.newFileGapTime))
-		fileLogger.lastFileTime = fileLogger.lastFileTime.Add(fileLogger.newFileGapTime * time.Duration(rate))
-		file, err := fileLogger.createLogFile(fileLogger.fileNameFormatFunc(fileLogger.lastFileTime))
+// 压缩切换下来的文件, 按数量和时间清理历史文件
+func (fileLogger *RotateFileLogger) cleanup(rotatedFile string, currentFile string, options RotateOptions) {
+	defer fileLogger.cleanWg.Done()
+
+	fileLogger.cleanMn.Lock()
+	defer fileLogger.cleanMn.Unlock()
+
+	if options.Compress {
+		compressFile(rotatedFile)
+	}
+
+	if options.MaxBackups <= 0 && options.MaxAge <= 0 {
+		return
+	}
+
+	dir := fileLogger.dirPath
+	if len(dir) == 0 {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		path    string
+		modTime time.Time
+	}
+	// 多次切换的清理可能乱序执行, 软链接指向的才是最新的文件
+	skip := map[string]bool{filepath.Base(currentFile): true}
+	if target, err := os.Readlink(filepath.Join(dir, currentLogName)); err == nil {
+		skip[filepath.Base(target)] = true
+	}
+
+	backups := []backup{}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if !entry.Type().IsRegular() || skip[name] {
+			continue
+		}
+		if !strings.HasSuffix(name, ".log") && !strings.HasSuffix(name, ".log.gz") {
+			continue
+		}
+		info, err := entry.Info()
 		if err != nil {
-			file.Close()
-			panic(err)
+			continue
 		}
-		fileLogger.file = file
-		fileLogger.out = file
+		backups = append(backups, backup{path: path, modTime: info.ModTime()})
 	}
 
-	layout := "2006-01-01 15:04:05.999"
-	formatTime := now.Format(layout)
-	defer func() {
-		e := recover()
-		if e != nil {
-			panic(debug.Stack())
+	// 新的在前
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+
+	now := time.Now()
+	for i, b := range backups {
+		if (options.MaxBackups > 0 && i >= options.MaxBackups) || (options.MaxAge > 0 && now.Sub(b.modTime) > options.MaxAge) {
+			os.Remove(b.path)
 		}
-	}()
-	if len(formatTime) != len(layout) {
-		formatTime += ".000"[4-(len(layout)-len(formatTime)) : 4]
+	}
+}
+
+// 压缩为.gz并删除原文件, 失败时保留原文件
+func compressFile(fileName string) {
+	src, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(fileName+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return
 	}
 
-	values := make([]interface{}, 3)
-	values[0] = GetLogTypeNames(logType)
-	values[1] = formatTime
-	values[2] = fmt.Sprint(i)
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fileName + ".gz")
+		return
+	}
 
-	return format, values, true
+	os.Remove(fileName)
 }
 
-func (fileLogger *RotateFileLogger) SetNewFileGapTime(gapTime time.Duration) {
-	fileLogger.mn.Lock()
-	defer fileLogger.mn.Unlock()
-	fileLogger.newFileGapTime = gapTime
+func fileExists(fileName string) bool {
+	_, err := os.Lstat(fileName)
+	return err == nil
 }
 
+// 以默认配置创建, 创建文件失败时在之后写入时重试
 func NewRotateFileLogger(dir string) *RotateFileLogger {
 	fileLogger := new(RotateFileLogger)
 	fileLogger.Init(dir)
 	return fileLogger
 }
+
+// 按配置创建
+func OpenRotateFileLogger(dir string, options RotateOptions) (*RotateFileLogger, error) {
+	fileLogger := new(RotateFileLogger)
+	err := fileLogger.InitWithOptions(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return fileLogger, nil
+}
@@ -0,0 +1,200 @@
+package logs
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestFileLogger(t *testing.T, options RotateOptions) (*RotateFileLogger, string) {
+	dir := t.TempDir()
+	fileLogger, err := OpenRotateFileLogger(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fileLogger.Close() })
+	return fileLogger, dir
+}
+
+func readFile(t *testing.T, path string) string {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func logFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotateFileLoggerMaxSize(t *testing.T) {
+	fileLogger, dir := openTestFileLogger(t, RotateOptions{MaxSize: 10})
+	// 固定文件名, 切分时文件名冲突
+	fileLogger.fileNameFormatFunc = func(time.Time) string { return "app.log" }
+	if err := fileLogger.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := fileLogger.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fileLogger.Close()
+
+	if got := readFile(t, filepath.Join(dir, "app.log")); got != "first\n" {
+		t.Errorf("app.log: got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.1.log")); got != "second\n" {
+		t.Errorf("app.1.log: got %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.2.log")); got != "third\n" {
+		t.Errorf("app.2.log: got %q", got)
+	}
+}
+
+func TestRotateFileLoggerInterval(t *testing.T) {
+	fileLogger, dir := openTestFileLogger(t, RotateOptions{Interval: time.Hour})
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	fileLogger.lastFileTime = start
+	now := start.Add(2*time.Hour + 30*time.Minute)
+	if !fileLogger.needRotate(now, 1) {
+		t.Fatal("want rotate after interval")
+	}
+
+	fileLogger.fileMn.Lock()
+	err := fileLogger.rotate(now)
+	fileLogger.fileMn.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 文件时间按间隔对齐到12:00
+	aligned := start.Add(2 * time.Hour)
+	if !fileLogger.lastFileTime.Equal(aligned) {
+		t.Errorf("lastFileTime: got %v, want %v", fileLogger.lastFileTime, aligned)
+	}
+	want := filepath.Join(dir, fileLogger.DefaultFileNameFormat(aligned))
+	if fileLogger.file.Name() != want {
+		t.Errorf("file: got %q, want %q", fileLogger.file.Name(), want)
+	}
+	if fileLogger.needRotate(aligned.Add(time.Minute), 1) {
+		t.Error("want no rotate within interval")
+	}
+}
+
+func TestRotateFileLoggerCleanup(t *testing.T) {
+	tests := []struct {
+		name    string
+		options RotateOptions
+		want    []string
+	}{
+		{"keep all", RotateOptions{}, []string{"a.log", "b.log", "c.log.gz", "d.log", "other.txt"}},
+		{"max backups", RotateOptions{MaxBackups: 2}, []string{"a.log", "b.log", "d.log", "other.txt"}},
+		{"max age", RotateOptions{MaxAge: 90 * time.Minute}, []string{"a.log", "b.log", "d.log", "other.txt"}},
+		{"both", RotateOptions{MaxBackups: 1, MaxAge: 90 * time.Minute}, []string{"a.log", "d.log", "other.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now()
+			// d.log为当前文件, 其他按修改时间从新到旧
+			files := map[string]time.Duration{
+				"d.log":     0,
+				"a.log":     -time.Minute,
+				"b.log":     -time.Hour,
+				"c.log.gz":  -2 * time.Hour,
+				"other.txt": -3 * time.Hour,
+			}
+			for name, age := range files {
+				path := filepath.Join(dir, name)
+				if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+					t.Fatal(err)
+				}
+				os.Chtimes(path, now.Add(age), now.Add(age))
+			}
+
+			fileLogger := &RotateFileLogger{dirPath: dir}
+			fileLogger.cleanWg.Add(1)
+			fileLogger.cleanup(filepath.Join(dir, "a.log"), filepath.Join(dir, "d.log"), tt.options)
+
+			if got := logFiles(t, dir); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateFileLoggerCompress(t *testing.T) {
+	fileLogger, dir := openTestFileLogger(t, RotateOptions{MaxSize: 4, Compress: true})
+	fileLogger.fileNameFormatFunc = func(time.Time) string { return "app.log" }
+	if err := fileLogger.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	fileLogger.Write([]byte("old\n"))
+	fileLogger.Write([]byte("new\n"))
+	fileLogger.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "app.log")); !os.IsNotExist(err) {
+		t.Fatalf("plain file should be removed, stat err: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "app.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "old\n" {
+		t.Errorf("gz content: got %q", bs)
+	}
+	if got := readFile(t, filepath.Join(dir, "app.1.log")); got != "new\n" {
+		t.Errorf("app.1.log: got %q", got)
+	}
+}
+
+func TestRotateFileLoggerCurrentLink(t *testing.T) {
+	fileLogger, dir := openTestFileLogger(t, RotateOptions{})
+	names := []string{"first.log", "second.log"}
+	for _, name := range names {
+		name := name
+		fileLogger.fileNameFormatFunc = func(time.Time) string { return name }
+		if err := fileLogger.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+
+		target, err := os.Readlink(filepath.Join(dir, currentLogName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != name {
+			t.Errorf("current.log: got %q, want %q", target, name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timeLayout = "2006-01-02 15:04:05.000"
+
+// 日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// 一条日志
+type Entry struct {
+	Time    time.Time
+	Level   LogType
+	Message string
+	Fields  []Field
+}
+
+// 日志格式化
+type Formatter interface {
+	Format(entry *Entry) ([]byte, error)
+}
+
+// 带颜色的控制台格式
+type ConsoleFormatter struct{}
+
+func (formatter *ConsoleFormatter) Format(entry *Entry) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("\033[" + logTypesColors[entry.Level] + "m")
+	writeTextEntry(buffer, entry)
+	buffer.WriteString(" \033[0m\n")
+	return buffer.Bytes(), nil
+}
+
+// 纯文本格式
+type TextFormatter struct{}
+
+func (formatter *TextFormatter) Format(entry *Entry) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	writeTextEntry(buffer, entry)
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+func writeTextEntry(buffer *bytes.Buffer, entry *Entry) {
+	buffer.WriteString(GetLogTypeNames(entry.Level))
+	buffer.WriteString(" [" + entry.Time.Format(timeLayout) + "] ")
+	buffer.WriteString(entry.Message)
+	for _, field := range entry.Fields {
+		buffer.WriteString(" " + field.Key + "=" + quoteValue(fieldValueString(field.Value)))
+	}
+}
+
+func quoteValue(s string) string {
+	if len(s) == 0 || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func fieldValueString(value interface{}) string {
+	if err, ok := value.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(value)
+}
+
+// JSON格式, 每条日志一行, 固定字段为time、level、msg
+type JSONFormatter struct{}
+
+func (formatter *JSONFormatter) Format(entry *Entry) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("{")
+	writeJSONField(buffer, "time", entry.Time.Format(time.RFC3339Nano))
+	buffer.WriteString(",")
+	writeJSONField(buffer, "level", strings.TrimSpace(GetLogTypeNames(entry.Level)))
+	buffer.WriteString(",")
+	writeJSONField(buffer, "msg", entry.Message)
+	for _, field := range entry.Fields {
+		buffer.WriteString(",")
+		writeJSONField(buffer, field.Key, field.Value)
+	}
+	buffer.WriteString("}\n")
+	return buffer.Bytes(), nil
+}
+
+func writeJSONField(buffer *bytes.Buffer, key string, value interface{}) {
+	bs, _ := json.Marshal(key)
+	buffer.Write(bs)
+	buffer.WriteString(":")
+
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	bs, err := json.Marshal(value)
+	if err != nil {
+		bs, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buffer.Write(bs)
+}
+
+// 把key-value参数转换为字段, key不是字符串或缺少value时记为!BADKEY
+func kvToFields(kv []interface{}) []Field {
+	fields := make([]Field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok || i+1 >= len(kv) {
+			fields = append(fields, Field{Key: "!BADKEY", Value: kv[i]})
+			i--
+			continue
+		}
+		fields = append(fields, Field{Key: key, Value: kv[i+1]})
+	}
+	return fields
+}
@@ -0,0 +1,37 @@
+package logs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKvToFields(t *testing.T) {
+	tests := []struct {
+		kv   []interface{}
+		want []Field
+	}{
+		{nil, []Field{}},
+		{[]interface{}{"a", 1, "b", "x"}, []Field{{"a", 1}, {"b", "x"}}},
+		{[]interface{}{"a"}, []Field{{"!BADKEY", "a"}}},
+		{[]interface{}{1, "a", 2}, []Field{{"!BADKEY", 1}, {"a", 2}}},
+		{[]interface{}{"a", 1, 2}, []Field{{"a", 1}, {"!BADKEY", 2}}},
+	}
+	for _, test := range tests {
+		if got := kvToFields(test.kv); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("kvToFields(%v) = %v, want %v", test.kv, got, test.want)
+		}
+	}
+}
+
+func TestDefaultLogFormatFunc(t *testing.T) {
+	format, values, ok := NewLogger().DefaultLogFormatFunc(WARN, "磁盘 快满了")
+	if !ok {
+		t.Fatal("not ok")
+	}
+	line := fmt.Sprintf(format, values...)
+	if !strings.HasPrefix(line, "WARN") || !strings.HasSuffix(line, "磁盘 快满了\n") {
+		t.Fatalf("got %q", line)
+	}
+}
@@ -0,0 +1,200 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// 设置日志级别的环境变量, 如"info,login=debug,http=warn"
+const LevelEnv = "WXCHAT_LOG_LEVEL"
+
+func (logType LogType) String() string {
+	if logType < DEBUG || int(logType) >= len(LogTypeNames) {
+		return fmt.Sprintf("LogType(%d)", int(logType))
+	}
+	return strings.TrimSpace(LogTypeNames[logType])
+}
+
+// 解析日志级别名称, 不区分大小写
+func ParseLogType(s string) (LogType, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "NOTICE":
+		return NOTICE, nil
+	case "WARN", "WARNING":
+		return WARN, nil
+	case "ERROR", "ERR":
+		return ERROR, nil
+	case "CRITICAL", "CRIT":
+		return CRITICAL, nil
+	case "FATAL":
+		return FATAL, nil
+	}
+	return DEBUG, fmt.Errorf("unknown log level: %q", s)
+}
+
+// 解析级别配置, 如"info,login=debug,http=warn", 不带模块名的一项为默认级别
+func ParseLevelSpec(spec string) (LogType, map[string]LogType, error) {
+	level := DEBUG
+	modules := map[string]LogType{}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) == 1 {
+			l, err := ParseLogType(parts[0])
+			if err != nil {
+				return DEBUG, nil, err
+			}
+			level = l
+			continue
+		}
+
+		module := strings.TrimSpace(parts[0])
+		l, err := ParseLogType(parts[1])
+		if err != nil {
+			return DEBUG, nil, err
+		}
+		modules[module] = l
+	}
+
+	return level, modules, nil
+}
+
+// 按级别配置设置默认级别和各模块的级别, 未出现的模块恢复为默认级别
+func (logger *Logger) SetLevelSpec(spec string) error {
+	level, modules, err := ParseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	core.logLevel = level
+	core.modules = modules
+	return nil
+}
+
+// 当前的级别配置
+func (logger *Logger) LevelSpec() string {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+
+	items := []string{strings.ToLower(core.logLevel.String())}
+	modules := []string{}
+	for module := range core.modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		items = append(items, module+"="+strings.ToLower(core.modules[module].String()))
+	}
+	return strings.Join(items, ",")
+}
+
+// 设置模块的级别
+func (logger *Logger) SetModuleLevel(module string, logType LogType) {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+
+	if core.modules == nil {
+		core.modules = map[string]LogType{}
+	}
+	core.modules[module] = logType
+}
+
+// 是否输出该级别的日志
+func (logger *Logger) Enabled(logType LogType) bool {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	return logger.level() <= logType
+}
+
+// 创建模块日志, 级别可以通过SetModuleLevel单独设置
+func (logger *Logger) Module(module string) *Logger {
+	child := logger.With("module", module)
+	child.module = module
+	return child
+}
+
+// 为任意日志实现创建模块日志, 只有*Logger支持按模块设置级别
+func WithModule(logger Interface, module string) Interface {
+	switch l := logger.(type) {
+	case *Logger:
+		return l.Module(module)
+	case *slogLogger:
+		return &slogLogger{logger: l.logger.With("module", module)}
+	}
+	return logger
+}
+
+// 从环境变量WXCHAT_LOG_LEVEL读取级别配置, 未设置时不修改
+func (logger *Logger) LoadLevelFromEnv() error {
+	spec, found := os.LookupEnv(LevelEnv)
+	if !found {
+		return nil
+	}
+	err := logger.SetLevelSpec(spec)
+	if err != nil {
+		return fmt.Errorf("%s: %s", LevelEnv, err.Error())
+	}
+	return nil
+}
+
+// 收到SIGHUP时从filePath重新读取级别配置, 返回的函数用于停止监听
+// 运行中的进程无法从外部修改环境变量, 所以必须指定文件
+func (logger *Logger) ReloadLevelOnSignal(filePath string) (func(), error) {
+	if len(filePath) == 0 {
+		return nil, errors.New("level file path is required")
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+				err := logger.reloadLevel(filePath)
+				if err != nil {
+					logger.Errorw("Reload Log Level Failed.", "err", err)
+				} else {
+					logger.Noticew("Log Level Reloaded.", "spec", logger.LevelSpec())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}, nil
+}
+
+func (logger *Logger) reloadLevel(filePath string) error {
+	bs, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return logger.SetLevelSpec(strings.TrimSpace(string(bs)))
+}
@@ -0,0 +1,81 @@
+package logs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseLogType(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    LogType
+		wantErr bool
+	}{
+		{"debug", DEBUG, false},
+		{" INFO ", INFO, false},
+		{"Notice", NOTICE, false},
+		{"warn", WARN, false},
+		{"warning", WARN, false},
+		{"err", ERROR, false},
+		{"crit", CRITICAL, false},
+		{"fatal", FATAL, false},
+		{"", DEBUG, true},
+		{"verbose", DEBUG, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLogType(tt.s)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseLogType(%q) = %v, %v; want %v, err %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseLevelSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		level   LogType
+		modules map[string]LogType
+		wantErr bool
+	}{
+		{"", DEBUG, map[string]LogType{}, false},
+		{"info", INFO, map[string]LogType{}, false},
+		{"warn,login=debug, http = error", WARN, map[string]LogType{"login": DEBUG, "http": ERROR}, false},
+		{"login=debug", DEBUG, map[string]LogType{"login": DEBUG}, false},
+		{"login=debug,,info,", INFO, map[string]LogType{"login": DEBUG}, false},
+		{"loud", DEBUG, nil, true},
+		{"info,login=loud", DEBUG, nil, true},
+		{"info,login=", DEBUG, nil, true},
+	}
+
+	for _, tt := range tests {
+		level, modules, err := ParseLevelSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevelSpec(%q): err %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if level != tt.level || !reflect.DeepEqual(modules, tt.modules) {
+			t.Errorf("ParseLevelSpec(%q) = %v, %v; want %v, %v", tt.spec, level, modules, tt.level, tt.modules)
+		}
+	}
+}
+
+func TestReloadLevel(t *testing.T) {
+	logger := NewLogger()
+	if _, err := logger.ReloadLevelOnSignal(""); err == nil {
+		t.Fatal("want error for empty file path")
+	}
+
+	path := filepath.Join(t.TempDir(), "loglevel.conf")
+	if err := ioutil.WriteFile(path, []byte("warn,login=debug\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.reloadLevel(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := logger.LevelSpec(); got != "warn,login=debug" {
+		t.Errorf("got %q, want %q", got, "warn,login=debug")
+	}
+}
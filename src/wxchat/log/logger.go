@@ -59,10 +59,16 @@ var logTypesColors = []string{"0;34", "0;32", "0;36", "1;33", "1;31", "1;31", "7
 日志
 */
 type Logger struct {
-	mn            sync.Mutex
-	out           io.Writer
-	logFormatFunc func(logType LogType, i interface{}) (string, []interface{}, bool)
-	logLevel      LogType
+	mn        sync.Mutex
+	out       io.Writer
+	formatter Formatter
+	logLevel  LogType
+	root      *Logger // With创建的子日志共享root的输出和级别
+	fields    []Field
+	sinks     []*Sink
+	onError   func(sinkName string, err error)
+	module    string             // 模块名, 用于按模块设置级别
+	modules   map[string]LogType // 各模块的级别, 未设置的使用logLevel
 }
 
 /**
@@ -71,100 +77,219 @@ type Logger struct {
 func (logger *Logger) Init() {
 	logger.mn.Lock()
 	defer logger.mn.Unlock()
-	logger.logFormatFunc = logger.DefaultLogFormatFunc
+	logger.formatter = &ConsoleFormatter{}
 	logger.out = os.Stdout
 	logger.logLevel = DEBUG
 }
 
+func (logger *Logger) core() *Logger {
+	if logger.root != nil {
+		return logger.root
+	}
+	return logger
+}
+
 /**
 设置日志级别
 */
 func (logger *Logger) SetLogLevel(logType LogType) {
-	logger.mn.Lock()
-	defer logger.mn.Unlock()
-	logger.logLevel = logType
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	core.logLevel = logType
 }
 
 /**
 获取日志级别
 */
 func (logger *Logger) GetLogLevel() LogType {
-	logger.mn.Lock()
-	defer logger.mn.Unlock()
-	return logger.logLevel
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	return core.logLevel
 }
 
 /**
-设置格式化log输出函数
+设置日志格式
 */
-func (logger *Logger) setLoggerFormat(formatFunc func(logType LogType, i interface{}) (string, []interface{}, bool)) {
-	logger.mn.Lock()
-	defer logger.mn.Unlock()
-	logger.logFormatFunc = formatFunc
+func (logger *Logger) SetFormatter(formatter Formatter) {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	core.formatter = formatter
+}
+
+/**
+设置日志输出
+*/
+func (logger *Logger) SetOutput(out io.Writer) {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	core.out = out
 }
 
+/**
+按文本格式格式化一条日志, 返回值可以直接传给fmt.Sprintf
+
+Deprecated: 请使用TextFormatter或SetFormatter
+*/
 func (logger *Logger) DefaultLogFormatFunc(logType LogType, i interface{}) (string, []interface{}, bool) {
-	format := "\033[" + logTypesColors[logType] + "m%s [%s] %s \033[0m\n"
-	layout := "2006-01-01 15:04:05.999"
-	formatTime := time.Now().Format(layout)
+	bs, err := (&TextFormatter{}).Format(&Entry{
+		Time:    time.Now(),
+		Level:   logType,
+		Message: fmt.Sprint(i),
+	})
+	if err != nil {
+		return "", nil, false
+	}
+	return "%s", []interface{}{string(bs)}, true
+}
 
-	if len(formatTime) != len(layout) {
-		//fmt.Println(len(layout) - len(formatTime))
-		formatTime += ".000"[4-(len(layout)-len(formatTime)) : 4]
+/**
+创建带固定字段的子日志, kv为key-value对
+*/
+func (logger *Logger) With(kv ...interface{}) *Logger {
+	return logger.withFields(kvToFields(kv))
+}
+
+func (logger *Logger) withFields(extra []Field) *Logger {
+	fields := make([]Field, 0, len(logger.fields)+len(extra))
+	fields = append(fields, logger.fields...)
+	fields = append(fields, extra...)
+
+	return &Logger{
+		root:   logger.core(),
+		fields: fields,
+		module: logger.module,
 	}
-	values := make([]interface{}, 3)
-	values[0] = LogTypeNames[logType]
-	values[1] = formatTime
-	values[2] = fmt.Sprint(i)
+}
 
-	return format, values, true
+// 当前日志对应的级别, 需在持有core的锁时调用
+func (logger *Logger) level() LogType {
+	core := logger.core()
+	if level, found := core.modules[logger.module]; found && len(logger.module) > 0 {
+		return level
+	}
+	return core.logLevel
 }
 
-func (logger *Logger) log(logType LogType, i interface{}) {
-	logger.mn.Lock()
-	defer logger.mn.Unlock()
+func (logger *Logger) log(logType LogType, msg string, fields []Field) {
+	core := logger.core()
+	core.mn.Lock()
 
-	if logger.logLevel > logType {
+	if logger.level() > logType {
+		core.mn.Unlock()
 		return
 	}
 
-	format, data, isLog := logger.logFormatFunc(logType, i)
-	if !isLog {
-		return
+	entry := &Entry{
+		Time:    time.Now(),
+		Level:   logType,
+		Message: msg,
+		Fields:  make([]Field, 0, len(logger.fields)+len(fields)),
+	}
+	entry.Fields = append(entry.Fields, logger.fields...)
+	entry.Fields = append(entry.Fields, fields...)
+
+	failed := []sinkError{}
+	if core.out != nil {
+		if err := write(core.out, core.formatter, entry); err != nil {
+			failed = append(failed, sinkError{defaultSinkName, err})
+		}
 	}
+	for _, sink := range core.sinks {
+		if sink.Level <= logType {
+			if err := write(sink.Out, sink.Formatter, entry); err != nil {
+				failed = append(failed, sinkError{sink.Name, err})
+			}
+		}
+	}
+	onError := core.onError
+	core.mn.Unlock()
+
+	// 解锁后再处理写入失败, 处理函数中可以继续写日志
+	for _, failure := range failed {
+		if onError != nil {
+			onError(failure.sinkName, failure.err)
+		} else {
+			fmt.Fprintf(os.Stderr, "log sink %s write failed: %s\n", failure.sinkName, failure.err.Error())
+		}
+	}
+}
 
-	_, err := fmt.Fprintf(logger.out, format, data...)
+// 写入失败的输出
+type sinkError struct {
+	sinkName string
+	err      error
+}
+
+// 写入失败不影响调用方和其他输出
+func write(out io.Writer, formatter Formatter, entry *Entry) error {
+	bs, err := formatter.Format(entry)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	if levelOut, ok := out.(levelWriter); ok {
+		return levelOut.WriteLevel(entry.Level, bs)
+	}
+	_, err = out.Write(bs)
+	return err
 }
 
 // 输出信息
 func (logger *Logger) Debug(i interface{}) {
-	logger.log(DEBUG, i)
+	logger.log(DEBUG, fmt.Sprint(i), nil)
 }
 func (logger *Logger) Info(i interface{}) {
-	logger.log(INFO, i)
+	logger.log(INFO, fmt.Sprint(i), nil)
 }
 func (logger *Logger) Notice(i interface{}) {
-	logger.log(NOTICE, i)
+	logger.log(NOTICE, fmt.Sprint(i), nil)
 }
 func (logger *Logger) Warn(i interface{}) {
-	logger.log(WARN, i)
+	logger.log(WARN, fmt.Sprint(i), nil)
 }
 func (logger *Logger) Error(i interface{}) {
-	logger.log(ERROR, i)
+	logger.log(ERROR, fmt.Sprint(i), nil)
 }
 func (logger *Logger) Critical(i interface{}) {
-	logger.log(CRITICAL, i)
+	logger.log(CRITICAL, fmt.Sprint(i), nil)
 }
 func (logger *Logger) Fatal(i interface{}) {
-	logger.log(FATAL, i)
+	logger.log(FATAL, fmt.Sprint(i), nil)
+}
+
+// 输出带字段的信息, kv为key-value对
+func (logger *Logger) Debugw(msg string, kv ...interface{}) {
+	logger.log(DEBUG, msg, kvToFields(kv))
+}
+func (logger *Logger) Infow(msg string, kv ...interface{}) {
+	logger.log(INFO, msg, kvToFields(kv))
+}
+func (logger *Logger) Noticew(msg string, kv ...interface{}) {
+	logger.log(NOTICE, msg, kvToFields(kv))
+}
+func (logger *Logger) Warnw(msg string, kv ...interface{}) {
+	logger.log(WARN, msg, kvToFields(kv))
+}
+func (logger *Logger) Errorw(msg string, kv ...interface{}) {
+	logger.log(ERROR, msg, kvToFields(kv))
+}
+func (logger *Logger) Criticalw(msg string, kv ...interface{}) {
+	logger.log(CRITICAL, msg, kvToFields(kv))
+}
+func (logger *Logger) Fatalw(msg string, kv ...interface{}) {
+	logger.log(FATAL, msg, kvToFields(kv))
 }
 
 func NewLogger() *Logger {
 	logger := new(Logger)
 	logger.Init()
+	err := logger.LoadLevelFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
 	return logger
 }
 
@@ -0,0 +1,153 @@
+package logs
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const defaultSinkName = "default"
+
+// 日志输出, 每个输出有独立的级别和格式
+type Sink struct {
+	Name      string
+	Out       io.Writer
+	Level     LogType
+	Formatter Formatter
+}
+
+// 按日志级别写入的输出, 如syslog
+type levelWriter interface {
+	WriteLevel(level LogType, p []byte) error
+}
+
+// 控制台输出
+func NewConsoleSink(level LogType) *Sink {
+	return &Sink{
+		Name:      "console",
+		Out:       os.Stdout,
+		Level:     level,
+		Formatter: &ConsoleFormatter{},
+	}
+}
+
+// 文件输出
+func NewFileSink(fileLogger *RotateFileLogger, level LogType) *Sink {
+	return &Sink{
+		Name:      "file",
+		Out:       fileLogger,
+		Level:     level,
+		Formatter: &TextFormatter{},
+	}
+}
+
+// 内存环形缓冲输出, 用于测试
+func NewRingSink(ring *RingBuffer, level LogType) *Sink {
+	return &Sink{
+		Name:      "ring",
+		Out:       ring,
+		Level:     level,
+		Formatter: &TextFormatter{},
+	}
+}
+
+// 多输出日志, 只写入各个sink
+func NewFanoutLogger(sinks ...*Sink) *Logger {
+	logger := NewLogger()
+	logger.out = nil
+	logger.sinks = sinks
+	return logger
+}
+
+// 添加输出
+func (logger *Logger) AddSink(sink *Sink) {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	core.sinks = append(core.sinks, sink)
+}
+
+// 修改输出的级别, 未找到该输出时返回false
+func (logger *Logger) SetSinkLevel(name string, level LogType) bool {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+
+	for _, sink := range core.sinks {
+		if sink.Name == name {
+			sink.Level = level
+			return true
+		}
+	}
+	return false
+}
+
+// 设置输出写入失败时的处理, 默认打印到标准错误; 在写完所有输出后调用, 可以在其中写日志
+func (logger *Logger) SetErrorHandler(onError func(sinkName string, err error)) {
+	core := logger.core()
+	core.mn.Lock()
+	defer core.mn.Unlock()
+	core.onError = onError
+}
+
+// syslog自带时间和级别, 只输出消息和字段
+type SyslogFormatter struct{}
+
+func (formatter *SyslogFormatter) Format(entry *Entry) ([]byte, error) {
+	text := entry.Message
+	for _, field := range entry.Fields {
+		text += " " + field.Key + "=" + quoteValue(fieldValueString(field.Value))
+	}
+	return []byte(text), nil
+}
+
+// 保存最近的若干条日志
+type RingBuffer struct {
+	mn    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func NewRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingBuffer{lines: make([]string, size)}
+}
+
+func (ring *RingBuffer) Write(p []byte) (int, error) {
+	ring.mn.Lock()
+	defer ring.mn.Unlock()
+
+	ring.lines[ring.next] = strings.TrimRight(string(p), "\n")
+	ring.next = (ring.next + 1) % len(ring.lines)
+	if ring.next == 0 {
+		ring.full = true
+	}
+	return len(p), nil
+}
+
+// 按写入顺序返回缓冲中的日志
+func (ring *RingBuffer) Lines() []string {
+	ring.mn.Lock()
+	defer ring.mn.Unlock()
+
+	if !ring.full {
+		return append([]string{}, ring.lines[:ring.next]...)
+	}
+	return append(append([]string{}, ring.lines[ring.next:]...), ring.lines[:ring.next]...)
+}
+
+// 清空缓冲
+func (ring *RingBuffer) Reset() {
+	ring.mn.Lock()
+	defer ring.mn.Unlock()
+
+	for i := range ring.lines {
+		ring.lines[i] = ""
+	}
+	ring.next = 0
+	ring.full = false
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package logs
+
+import "errors"
+
+// 当前平台不支持syslog
+func NewSyslogSink(tag string, level LogType) (*Sink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
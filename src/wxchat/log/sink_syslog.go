@@ -0,0 +1,54 @@
+//go:build !windows && !plan9
+
+package logs
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// 本机syslog输出, 通过/dev/log等本地socket发送
+func NewSyslogSink(tag string, level LogType) (*Sink, error) {
+	writer, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{
+		Name:      "syslog",
+		Out:       &syslogWriter{writer: writer},
+		Level:     level,
+		Formatter: &SyslogFormatter{},
+	}, nil
+}
+
+type syslogWriter struct {
+	writer *syslog.Writer
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	err := w.WriteLevel(INFO, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *syslogWriter) WriteLevel(level LogType, p []byte) error {
+	msg := strings.TrimRight(string(p), "\n")
+	switch level {
+	case DEBUG:
+		return w.writer.Debug(msg)
+	case INFO:
+		return w.writer.Info(msg)
+	case NOTICE:
+		return w.writer.Notice(msg)
+	case WARN:
+		return w.writer.Warning(msg)
+	case ERROR:
+		return w.writer.Err(msg)
+	case CRITICAL:
+		return w.writer.Crit(msg)
+	default:
+		return w.writer.Alert(msg)
+	}
+}
@@ -0,0 +1,94 @@
+package logs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 总是写入失败的输出
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestFanoutLoggerSinkLevel(t *testing.T) {
+	debugRing := NewRingBuffer(10)
+	warnRing := NewRingBuffer(10)
+	logger := NewFanoutLogger(&Sink{Name: "debug", Out: debugRing, Level: DEBUG, Formatter: &SyslogFormatter{}})
+	logger.AddSink(&Sink{Name: "warn", Out: warnRing, Level: WARN, Formatter: &SyslogFormatter{}})
+
+	logger.Info("info")
+	logger.Error("error")
+
+	if got := debugRing.Lines(); !reflect.DeepEqual(got, []string{"info", "error"}) {
+		t.Errorf("debug sink: got %v", got)
+	}
+	if got := warnRing.Lines(); !reflect.DeepEqual(got, []string{"error"}) {
+		t.Errorf("warn sink: got %v", got)
+	}
+
+	if !logger.SetSinkLevel("warn", INFO) {
+		t.Fatal("sink warn not found")
+	}
+	if logger.SetSinkLevel("unknown", INFO) {
+		t.Error("unknown sink found")
+	}
+	logger.Info("info again")
+	if got := warnRing.Lines(); !reflect.DeepEqual(got, []string{"error", "info again"}) {
+		t.Errorf("warn sink after SetSinkLevel: got %v", got)
+	}
+}
+
+func TestRingBufferWraps(t *testing.T) {
+	ring := NewRingBuffer(3)
+	if got := ring.Lines(); len(got) != 0 {
+		t.Fatalf("empty ring: got %v", got)
+	}
+
+	for _, line := range []string{"1", "2"} {
+		ring.Write([]byte(line + "\n"))
+	}
+	if got := ring.Lines(); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("not full: got %v", got)
+	}
+
+	for _, line := range []string{"3", "4", "5"} {
+		ring.Write([]byte(line + "\n"))
+	}
+	if got := ring.Lines(); !reflect.DeepEqual(got, []string{"3", "4", "5"}) {
+		t.Errorf("wrapped: got %v", got)
+	}
+
+	ring.Reset()
+	if got := ring.Lines(); len(got) != 0 {
+		t.Errorf("after reset: got %v", got)
+	}
+}
+
+func TestSinkErrorHandler(t *testing.T) {
+	ring := NewRingBuffer(10)
+	logger := NewFanoutLogger(
+		&Sink{Name: "broken", Out: failingWriter{}, Level: WARN, Formatter: &SyslogFormatter{}},
+		&Sink{Name: "memory", Out: ring, Level: INFO, Formatter: &SyslogFormatter{}},
+	)
+
+	failed := []string{}
+	logger.SetErrorHandler(func(sinkName string, err error) {
+		failed = append(failed, sinkName+": "+err.Error())
+		// 处理函数中写日志不会死锁, 级别低于broken不会再次失败
+		logger.Infow("sink failed", "sink", sinkName)
+	})
+
+	logger.Error("boom")
+
+	if !reflect.DeepEqual(failed, []string{"broken: disk full"}) {
+		t.Errorf("error handler: got %v", failed)
+	}
+	lines := ring.Lines()
+	if len(lines) != 2 || lines[0] != "boom" || !strings.HasPrefix(lines[1], "sink failed sink=broken") {
+		t.Errorf("other sink: got %v", lines)
+	}
+}
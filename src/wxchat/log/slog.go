@@ -0,0 +1,199 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// WxChat依赖的日志接口, *Logger和NewSlogLogger的返回值都实现了该接口
+type Interface interface {
+	Debug(i interface{})
+	Info(i interface{})
+	Notice(i interface{})
+	Warn(i interface{})
+	Error(i interface{})
+	Critical(i interface{})
+	Fatal(i interface{})
+
+	Debugw(msg string, kv ...interface{})
+	Infow(msg string, kv ...interface{})
+	Noticew(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+	Criticalw(msg string, kv ...interface{})
+	Fatalw(msg string, kv ...interface{})
+}
+
+var _ Interface = (*Logger)(nil)
+
+// slog中没有的级别
+const (
+	LevelNotice   = slog.Level(2)
+	LevelCritical = slog.Level(12)
+	LevelFatal    = slog.Level(16)
+)
+
+var slogLevels = []slog.Level{
+	slog.LevelDebug,
+	slog.LevelInfo,
+	LevelNotice,
+	slog.LevelWarn,
+	slog.LevelError,
+	LevelCritical,
+	LevelFatal,
+}
+
+// 日志级别对应的slog级别
+func SlogLevel(logType LogType) slog.Level {
+	return slogLevels[logType]
+}
+
+// slog级别对应的日志级别, 向下取最接近的级别
+func FromSlogLevel(level slog.Level) LogType {
+	for i := len(slogLevels) - 1; i > 0; i-- {
+		if level >= slogLevels[i] {
+			return LogType(i)
+		}
+	}
+	return DEBUG
+}
+
+// 用于slog.HandlerOptions.ReplaceAttr, 输出NOTICE、CRITICAL、FATAL级别名称
+func ReplaceLevelAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 || attr.Key != slog.LevelKey {
+		return attr
+	}
+	level, ok := attr.Value.Any().(slog.Level)
+	if !ok {
+		return attr
+	}
+	switch level {
+	case LevelNotice, LevelCritical, LevelFatal:
+		attr.Value = slog.StringValue(strings.TrimSpace(GetLogTypeNames(FromSlogLevel(level))))
+	}
+	return attr
+}
+
+// 把Logger作为slog.Handler使用
+type slogHandler struct {
+	logger *Logger
+	prefix string // WithGroup的分组前缀
+}
+
+func NewSlogHandler(logger *Logger) slog.Handler {
+	return &slogHandler{logger: logger}
+}
+
+func (handler *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.logger.Enabled(FromSlogLevel(level))
+}
+
+func (handler *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make([]Field, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, handler.prefix, attr)
+		return true
+	})
+
+	handler.logger.log(FromSlogLevel(record.Level), record.Message, fields)
+	return nil
+}
+
+func (handler *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := []Field{}
+	for _, attr := range attrs {
+		fields = appendAttr(fields, handler.prefix, attr)
+	}
+	return &slogHandler{
+		logger: handler.logger.withFields(fields),
+		prefix: handler.prefix,
+	}
+}
+
+func (handler *slogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return handler
+	}
+	return &slogHandler{
+		logger: handler.logger,
+		prefix: handler.prefix + name + ".",
+	}
+}
+
+// 分组展开为"group.key"
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if len(attr.Key) > 0 {
+			groupPrefix += attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			fields = appendAttr(fields, groupPrefix, a)
+		}
+		return fields
+	}
+	if len(attr.Key) == 0 {
+		return fields
+	}
+	return append(fields, Field{Key: prefix + attr.Key, Value: value.Any()})
+}
+
+// 把slog.Logger作为WxChat的日志使用
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func NewSlogLogger(logger *slog.Logger) Interface {
+	return &slogLogger{logger: logger}
+}
+
+func (logger *slogLogger) log(logType LogType, msg string, kv []interface{}) {
+	logger.logger.Log(context.Background(), SlogLevel(logType), msg, kv...)
+}
+
+func (logger *slogLogger) Debug(i interface{}) {
+	logger.log(DEBUG, fmt.Sprint(i), nil)
+}
+func (logger *slogLogger) Info(i interface{}) {
+	logger.log(INFO, fmt.Sprint(i), nil)
+}
+func (logger *slogLogger) Notice(i interface{}) {
+	logger.log(NOTICE, fmt.Sprint(i), nil)
+}
+func (logger *slogLogger) Warn(i interface{}) {
+	logger.log(WARN, fmt.Sprint(i), nil)
+}
+func (logger *slogLogger) Error(i interface{}) {
+	logger.log(ERROR, fmt.Sprint(i), nil)
+}
+func (logger *slogLogger) Critical(i interface{}) {
+	logger.log(CRITICAL, fmt.Sprint(i), nil)
+}
+func (logger *slogLogger) Fatal(i interface{}) {
+	logger.log(FATAL, fmt.Sprint(i), nil)
+}
+
+func (logger *slogLogger) Debugw(msg string, kv ...interface{}) {
+	logger.log(DEBUG, msg, kv)
+}
+func (logger *slogLogger) Infow(msg string, kv ...interface{}) {
+	logger.log(INFO, msg, kv)
+}
+func (logger *slogLogger) Noticew(msg string, kv ...interface{}) {
+	logger.log(NOTICE, msg, kv)
+}
+func (logger *slogLogger) Warnw(msg string, kv ...interface{}) {
+	logger.log(WARN, msg, kv)
+}
+func (logger *slogLogger) Errorw(msg string, kv ...interface{}) {
+	logger.log(ERROR, msg, kv)
+}
+func (logger *slogLogger) Criticalw(msg string, kv ...interface{}) {
+	logger.log(CRITICAL, msg, kv)
+}
+func (logger *slogLogger) Fatalw(msg string, kv ...interface{}) {
+	logger.log(FATAL, msg, kv)
+}
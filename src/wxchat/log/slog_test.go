@@ -0,0 +1,111 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 记录格式化前的日志
+type captureFormatter struct {
+	entries []Entry
+}
+
+func (formatter *captureFormatter) Format(entry *Entry) ([]byte, error) {
+	formatter.entries = append(formatter.entries, *entry)
+	return []byte(entry.Message + "\n"), nil
+}
+
+func newCaptureLogger(level LogType) (*Logger, *captureFormatter) {
+	capture := &captureFormatter{}
+	return NewFanoutLogger(&Sink{Name: "capture", Out: ioutil.Discard, Level: level, Formatter: capture}), capture
+}
+
+func TestSlogLevelMapping(t *testing.T) {
+	for logType := DEBUG; logType <= FATAL; logType++ {
+		if got := FromSlogLevel(SlogLevel(logType)); got != logType {
+			t.Errorf("round trip %v: got %v", logType, got)
+		}
+	}
+
+	tests := []struct {
+		level slog.Level
+		want  LogType
+	}{
+		{slog.Level(-8), DEBUG},
+		{slog.LevelDebug, DEBUG},
+		{slog.LevelInfo, INFO},
+		{slog.Level(3), NOTICE},
+		{slog.LevelWarn, WARN},
+		{slog.LevelError, ERROR},
+		{slog.Level(13), CRITICAL},
+		{slog.Level(20), FATAL},
+	}
+	for _, tt := range tests {
+		if got := FromSlogLevel(tt.level); got != tt.want {
+			t.Errorf("FromSlogLevel(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	logger, capture := newCaptureLogger(INFO)
+	sl := slog.New(NewSlogHandler(logger)).With("a", 1).WithGroup("g")
+
+	sl.Debug("skipped")
+	sl.Log(context.Background(), LevelNotice, "hello", "b", "x", slog.Group("sub", "c", true))
+
+	if len(capture.entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(capture.entries))
+	}
+	entry := capture.entries[0]
+	if entry.Level != NOTICE || entry.Message != "hello" {
+		t.Errorf("got level %v message %q", entry.Level, entry.Message)
+	}
+	want := []Field{{"a", int64(1)}, {"g.b", "x"}, {"g.sub.c", true}}
+	if !reflect.DeepEqual(entry.Fields, want) {
+		t.Errorf("fields: got %v, want %v", entry.Fields, want)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	handler := slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: ReplaceLevelAttr})
+	logger := WithModule(NewSlogLogger(slog.New(handler)), "login")
+
+	logger.Noticew("notice", "k", "v")
+	logger.Criticalw("critical")
+	logger.Fatal("fatal")
+	logger.Warn("warn")
+
+	tests := []struct {
+		level string
+		msg   string
+	}{
+		{"NOTICE", "notice"},
+		{"CRITICAL", "critical"},
+		{"FATAL", "fatal"},
+		{"WARN", "warn"},
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(tests))
+	}
+	for i, tt := range tests {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["level"] != tt.level || record["msg"] != tt.msg || record["module"] != "login" {
+			t.Errorf("line %d: got %v", i, record)
+		}
+	}
+	if !strings.Contains(lines[0], `"k":"v"`) {
+		t.Errorf("fields: got %s", lines[0])
+	}
+}
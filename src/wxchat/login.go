@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -20,7 +21,9 @@ type pushLoginResponse struct {
 
 func (wx *WxChat) beginLogin() error {
 	var err error
-	wx.Uuid, wx.baseRequest, wx.passTicket, wx.httpClient.Cookies, wx.host, err = wx.storage.getData()
+	var cookies []*http.Cookie
+	wx.Uuid, wx.baseRequest, wx.passTicket, cookies, wx.host, err = wx.storage.getData()
+	wx.httpClient.setCookies(cookies)
 	if err != nil {
 		wx.Uuid, err = wx.getUuid()
 		if err != nil {
@@ -28,7 +31,7 @@ func (wx *WxChat) beginLogin() error {
 		}
 
 		wx.triggerGenUuidEvent(wx.Uuid)
-		wx.logger.Info("Uuid=" + wx.Uuid)
+		wx.log(moduleLogin).Infow("Gen Uuid.", "uuid", wx.Uuid)
 		err = wx.GetLoginQrcode(wx.Uuid)
 		if err != nil {
 			return err
@@ -38,21 +41,21 @@ func (wx *WxChat) beginLogin() error {
 		for {
 			status, result, err := wx.isAuth(tip)
 			if err != nil {
-				wx.logger.Error("GetRedirectUrl Error :" + err.Error())
+				wx.log(moduleLogin).Errorw("GetRedirectUrl Error.", "err", err)
 				time.Sleep(time.Second * time.Duration(1))
 				continue
 			}
 
 			if 200 == status {
 				redirectUrl = result
-				wx.logger.Info("Redirect=" + redirectUrl)
+				wx.log(moduleLogin).Infow("Confirm Auth.", "redirect", redirectUrl)
 				wx.triggerConfirmAuthEvent(redirectUrl)
 				break
 			}
 
 			if 201 == status {
 				tip = 0
-				wx.logger.Info("Scan Code")
+				wx.log(moduleLogin).Infow("Scan Code.")
 				wx.triggerScanCodeEvent(result)
 			}
 		}
@@ -63,10 +66,10 @@ func (wx *WxChat) beginLogin() error {
 			return err
 		}
 
-		wx.storage.setData(wx.Uuid, wx.baseRequest, wx.passTicket, wx.httpClient.Cookies, wx.host)
+		wx.storage.setData(wx.Uuid, wx.baseRequest, wx.passTicket, wx.httpClient.getCookies(), wx.host)
 	}
 
-	wx.logger.Info("Login.")
+	wx.log(moduleLogin).Infow("Login.", "nickName", wx.me.NickName)
 	wx.triggerLoginEvent(wx.baseRequest.DeviceID)
 
 	return nil
@@ -91,7 +94,7 @@ func (wx *WxChat) getUuid() (string, error) {
 
 	uuidArr := reg.FindSubmatch([]byte(content))
 	if len(uuidArr) != 2 {
-		wx.logger.Error("Uuid get failed")
+		wx.log(moduleLogin).Errorw("Uuid Get Failed.")
 		return "", errors.New("Uuid get failed")
 	}
 
@@ -107,7 +110,6 @@ func (wx *WxChat) GetLoginQrcode(uuid string) error {
 	if err != nil {
 		return err
 	}
-	//fmt.Println(content)
 	return ioutil.WriteFile("./qrcode.png", []byte(content), 0700)
 }
 
@@ -185,7 +187,7 @@ func (wx *WxChat) pushLogin() (string, error) {
 	}
 
 	if pushLoginResp.Ret != "0" || "" == pushLoginResp.Uuid {
-		wx.logger.Error("Push Login Failed")
+		wx.log(moduleLogin).Errorw("Push Login Failed.")
 		return "", errors.New("Push Login Failed")
 	}
 
@@ -0,0 +1,109 @@
+package wxchat
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	logs "wxchat/log"
+)
+
+func TestIsMentioned(t *testing.T) {
+	tests := []struct {
+		content string
+		name    string
+		want    bool
+	}{
+		{"@张三 你好", "张三", true},
+		{"@张三 你好", "张三", true},
+		{"你好@张三", "张三", true},
+		{"@张三丰 你好", "张三", false},
+		{"@张三丰 @张三 你好", "张三", true},
+		{"张三 你好", "张三", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMentioned(tt.content, tt.name); got != tt.want {
+			t.Errorf("isMentioned(%q, %q) = %v, want %v", tt.content, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseAtUserNames(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.me = Contact{UserName: "@me", NickName: "我"}
+	wx.contacts.Put(&Contact{
+		UserName: "@@g",
+		Type:     Group,
+		OwnerUin: 100,
+		MemberMap: map[string]*Member{
+			"@me":    {UserName: "@me", NickName: "我", DisplayName: "小王"},
+			"@owner": {UserName: "@owner", Uin: 100, NickName: "群主"},
+			"@zs":    {UserName: "@zs", NickName: "张三"},
+			"@zsf":   {UserName: "@zsf", NickName: "张三丰"},
+		},
+	})
+
+	tests := []struct {
+		name      string
+		sender    string
+		content   string
+		msgSource string
+		want      []string
+	}{
+		{
+			name:      "atuserlist",
+			sender:    "@zs",
+			content:   "hi",
+			msgSource: "<msgsource><atuserlist><![CDATA[@me,@unknown]]></atuserlist></msgsource>",
+			want:      []string{"@me"},
+		},
+		{
+			name:      "atuserlist notify all",
+			sender:    "@zs",
+			content:   "hi",
+			msgSource: "&lt;msgsource&gt;&lt;atuserlist&gt;notify@all&lt;/atuserlist&gt;&lt;/msgsource&gt;",
+			want:      []string{MentionAll},
+		},
+		{
+			name:    "display name with separator",
+			sender:  "@zs",
+			content: "@小王 在吗",
+			want:    []string{"@me"},
+		},
+		{
+			name:    "nick name is not a mention when display name is set",
+			sender:  "@zs",
+			content: "@我 在吗",
+			want:    []string{},
+		},
+		{
+			name:    "prefix of another name",
+			sender:  "@owner",
+			content: "@张三丰 你好",
+			want:    []string{"@zsf"},
+		},
+		{
+			name:    "non owner typing at all",
+			sender:  "@zs",
+			content: "@所有人 开会",
+			want:    []string{},
+		},
+		{
+			name:    "owner at all",
+			sender:  "@owner",
+			content: "@所有人 开会",
+			want:    []string{MentionAll},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wx.parseAtUserNames("@@g", tt.sender, tt.content, tt.msgSource)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
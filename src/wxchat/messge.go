@@ -41,10 +41,19 @@ const (
 
 var mediaIndex int64 = 0
 
+// @所有人, 仅群主可用
+const MentionAll = "@all"
+
 func (wx *WxChat) SendTextMsg(content string, to string) (bool, error) {
+	return wx.sendTextMsg(content, to, "")
+}
+
+// msgSource不为空时一起发送, 如群消息的atuserlist
+func (wx *WxChat) sendTextMsg(content string, to string, msgSource string) (bool, error) {
 	sendMsgApi := strings.Replace(wxChatApi["sendMsgApi"], "{pass_ticket}", wx.passTicket, 1)
 	sendMsgApi = strings.Replace(sendMsgApi, "{host}", wx.host, 1)
 	msgId := utils.GetUnixMsTime() + strconv.Itoa(rand.Intn(10000))
+	content = utils.EncodeContent(content)
 	msg := map[string]interface{}{
 		"Content":      content,
 		"ToUserName":   to,
@@ -53,10 +62,14 @@ func (wx *WxChat) SendTextMsg(content string, to string) (bool, error) {
 		"ClientMsgId":  msgId,
 		"Type":         "1",
 	}
+	if len(msgSource) > 0 {
+		msg["MsgSource"] = msgSource
+	}
 
 	buffer := new(bytes.Buffer)
 	enc := json.NewEncoder(buffer)
-	// enc.SetEscapeHTML(false)
+	// 不转义<>&, 与网页版一致
+	enc.SetEscapeHTML(false)
 	err := enc.Encode(map[string]interface{}{
 		`BaseRequest`: wx.baseRequest,
 		`Msg`:         msg,
@@ -79,13 +92,76 @@ func (wx *WxChat) SendTextMsg(content string, to string) (bool, error) {
 	}
 
 	if resp.BaseResponse.Ret != 0 {
-		wx.logger.Error("Send Msg Error. [msgId]:" + msgId)
+		wx.log(moduleMessage).Errorw("Send Msg Error.", "msgId", msgId, "to", to)
 		return false, errors.New("Send Msg Error. [msgId]:" + msgId)
 	}
 
+	wx.archiveSent(TextMessage, to, content, resp.MsgID, msg)
+
 	return true, nil
 }
 
+// 发送群消息并@成员, mentions为成员的UserName, 传入MentionAll则@所有人
+func (wx *WxChat) SendGroupText(group string, text string, mentions []string) (bool, error) {
+	contact, found := wx.contacts.Get(group)
+	if !found {
+		return false, errors.New("Group Not Found. [group]:" + group)
+	}
+
+	// 不认识的成员先刷新群信息
+	for _, userName := range mentions {
+		if _, found := contact.MemberMap[userName]; !found && MentionAll != userName {
+			err := wx.updateContact([]string{group})
+			if err != nil {
+				return false, err
+			}
+			contact, _ = wx.contacts.Get(group)
+			break
+		}
+	}
+
+	content, msgSource, err := groupTextContent(contact, text, mentions)
+	if err != nil {
+		return false, err
+	}
+	return wx.sendTextMsg(content, group, msgSource)
+}
+
+// 生成@成员的内容和MsgSource
+func groupTextContent(group Contact, text string, mentions []string) (string, string, error) {
+	prefix := ""
+	atUserNames := []string{}
+	for _, userName := range mentions {
+		if MentionAll == userName {
+			if group.IsOwner == 0 {
+				return "", "", &GroupPermissionError{Op: "mentionall", Group: group.UserName}
+			}
+			prefix += "@所有人\u2005"
+			atUserNames = append(atUserNames, "notify@all")
+			continue
+		}
+
+		member, found := group.MemberMap[userName]
+		if !found {
+			return "", "", errors.New("Group Member Not Found. [userName]:" + userName)
+		}
+
+		name := member.DisplayName
+		if len(name) == 0 {
+			name = member.NickName
+		}
+		// 客户端以@昵称加四分之一空格(U+2005)识别@
+		prefix += "@" + name + "\u2005"
+		atUserNames = append(atUserNames, userName)
+	}
+
+	msgSource := ""
+	if len(atUserNames) > 0 {
+		msgSource = "<msgsource><atuserlist>" + strings.Join(atUserNames, ",") + "</atuserlist></msgsource>"
+	}
+	return prefix + text, msgSource, nil
+}
+
 // 发送图片消息
 func (wx *WxChat) SendImgMsg(toUserFrom string, mediaId string) error {
 	sendImgMsgApi := strings.Replace(wxChatApi["sendImgMsgApi"], "{host}", wx.host, 1)
@@ -125,10 +201,12 @@ func (wx *WxChat) SendImgMsg(toUserFrom string, mediaId string) error {
 	}
 
 	if resp.BaseResponse.Ret != 0 {
-		wx.logger.Error("Send Img Msg Error. [msgId]:" + msgId)
+		wx.log(moduleMessage).Errorw("Send Img Msg Error.", "msgId", msgId, "to", toUserFrom)
 		return errors.New("Send Img Msg Error. [msgId]:" + msgId)
 	}
 
+	wx.archiveSent(ImgMessage, toUserFrom, "", resp.MsgID, msg)
+
 	return nil
 }
 
@@ -178,10 +256,14 @@ func (wx *WxChat) SendAppMsg(toUserName string, mediaId string, filename string,
 	}
 
 	if resp.BaseResponse.Ret != 0 {
-		wx.logger.Error("Send Img Msg Error. [msgId]:" + msgId)
+		wx.log(moduleMessage).Errorw("Send App Msg Error.", "msgId", msgId, "to", toUserName)
 		return errors.New("Send App Msg Error. [msgId]:" + msgId)
 	}
 
+	// 与同步消息一致, 以MsgType标识App消息
+	msg["MsgType"] = float64(49)
+	wx.archiveSent(TextMessage, toUserName, content, resp.MsgID, msg)
+
 	return nil
 }
 
@@ -261,23 +343,36 @@ func (wx *WxChat) UploadMedia(buf []byte, mediaType MediaType, fileType string,
 			return resp.MediaId, nil
 		}
 	}
-	wx.logger.Error("UploadMedia Error")
+	wx.log(moduleMessage).Errorw("UploadMedia Error.", "to", toUserName)
 	return "", errors.New("UploadMedia Error")
 }
 
 // 授权好友请求
 func (wx *WxChat) VerifyUser(userName string, ticket string, verifyUserContent string) error {
+	return wx.verifyUser(3, userName, ticket, verifyUserContent, defaultVerifyScene)
+}
+
+// 添加好友, verifyContent为发给对方的验证消息
+func (wx *WxChat) AddFriend(userName string, verifyContent string) error {
+	return wx.verifyUser(2, userName, "", verifyContent, defaultVerifyScene)
+}
+
+// 未知来源时使用的场景值
+const defaultVerifyScene = 33
+
+// opcode: 2添加好友, 3通过好友请求; scene为好友请求的来源, 需与请求中的Scene一致
+func (wx *WxChat) verifyUser(opcode int, userName string, ticket string, verifyUserContent string, scene int) error {
 	verifyUserApi := strings.Replace(wxChatApi["verifyUserApi"], "{pass_ticket}", wx.passTicket, 1)
 	verifyUserApi = strings.Replace(verifyUserApi, "{host}", wx.host, 1)
 	verifyUserApi = strings.Replace(verifyUserApi, "{r}", utils.GetUnixMsTime(), 1)
 
 	buffer := new(bytes.Buffer)
 	enc := json.NewEncoder(buffer)
-	// enc.SetEscapeHTML(false)
+	enc.SetEscapeHTML(false)
 	err := enc.Encode(map[string]interface{}{
 		"BaseRequest":        wx.baseRequest,
-		"Opcode":             3,
-		"SceneList":          []int{33},
+		"Opcode":             opcode,
+		"SceneList":          []int{scene},
 		"SceneListCount":     1,
 		"VerifyContent":      verifyUserContent,
 		"VerifyUserList":     []map[string]string{{"Value": userName, "VerifyUserTicket": ticket}},
@@ -290,9 +385,13 @@ func (wx *WxChat) VerifyUser(userName string, ticket string, verifyUserContent s
 	}
 
 	respContent, err := wx.httpClient.post(verifyUserApi, []byte(buffer.String()), time.Second*5, &httpHeader{
-		Host:    wx.host,
-		Referer: "https://" + wx.host + "/?&lang=zh_CN",
+		ContentType: "application/json;charset=utf-8",
+		Host:        wx.host,
+		Referer:     "https://" + wx.host + "/?&lang=zh_CN",
 	})
+	if err != nil {
+		return err
+	}
 
 	var resp verifyUserResponse
 	err = json.Unmarshal([]byte(respContent), &resp)
@@ -300,8 +399,8 @@ func (wx *WxChat) VerifyUser(userName string, ticket string, verifyUserContent s
 		return err
 	}
 
-	if resp.BaseResponse.Ret != 0 {
-		wx.logger.Error("VerifyUser Error")
+	if resp.BaseResponse == nil || resp.BaseResponse.Ret != 0 {
+		wx.log(moduleMessage).Errorw("VerifyUser Error.", "opcode", opcode, "userName", userName, "ret", resp.BaseResponse)
 		return errors.New("VerifyUser Error")
 	}
 
@@ -0,0 +1,85 @@
+package wxchat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendGroupText(t *testing.T) {
+	members := map[string]*Member{
+		"@a": {UserName: "@a", NickName: "张三", DisplayName: "老张"},
+		"@b": {UserName: "@b", NickName: "李四"},
+	}
+
+	tests := []struct {
+		name      string
+		isOwner   float64
+		mentions  []string
+		content   string
+		msgSource string
+		err       error
+	}{
+		{
+			name:    "no mention",
+			content: "hi",
+		},
+		{
+			name:      "display name first",
+			mentions:  []string{"@a"},
+			content:   "@老张 hi",
+			msgSource: "<msgsource><atuserlist>@a</atuserlist></msgsource>",
+		},
+		{
+			name:      "nick name without display name",
+			mentions:  []string{"@a", "@b"},
+			content:   "@老张 @李四 hi",
+			msgSource: "<msgsource><atuserlist>@a,@b</atuserlist></msgsource>",
+		},
+		{
+			name:      "owner mentions all",
+			isOwner:   1,
+			mentions:  []string{MentionAll},
+			content:   "@所有人 hi",
+			msgSource: "<msgsource><atuserlist>notify@all</atuserlist></msgsource>",
+		},
+		{
+			name:     "non owner mentions all",
+			mentions: []string{MentionAll},
+			err:      ErrNotGroupOwner,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wx, stub := newStubWxChat(t, nil)
+			wx.contacts.Put(&Contact{UserName: "@@g", Type: Group, IsOwner: tt.isOwner, MemberMap: members})
+
+			_, err := wx.SendGroupText("@@g", "hi", tt.mentions)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				if len(stub.Requests()) != 0 {
+					t.Fatal("should not send")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requests := stub.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			msg, _ := requests[0].Body["Msg"].(map[string]interface{})
+			if got := msg["Content"]; got != tt.content {
+				t.Errorf("Content: got %q, want %q", got, tt.content)
+			}
+			msgSource, _ := msg["MsgSource"].(string)
+			if msgSource != tt.msgSource {
+				t.Errorf("MsgSource: got %q, want %q", msgSource, tt.msgSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package wxchat
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wxchat/fulltext"
+)
+
+// 消息搜索条件
+type SearchQuery struct {
+	Text   string // 关键词, 多个词需同时匹配
+	Sender string // 发送人的稳定ID, 或昵称/备注名/群昵称的一部分
+	Group  string // 群的稳定ID, 或群名称的一部分
+	Since  int64  // CreateTime >= Since, 0不限
+	Until  int64  // CreateTime < Until, 0不限
+	Limit  int    // 0时为20
+	// 排除的会话, 为UserName或稳定ID, 如"filehelper"
+	Exclude []string
+}
+
+// 搜索结果, Highlight为标记了匹配部分的摘要
+type Hit struct {
+	Message   ArchivedMessage
+	Score     float64
+	Highlight string
+}
+
+const (
+	defaultSearchLimit = 20
+	highlightMaxRunes  = 60
+	HighlightPre       = "【"
+	HighlightPost      = "】"
+)
+
+// 链接和文件消息的标题
+var appTitleReg = regexp.MustCompile(`<title>([^<]*)</title>`)
+
+// 存档消息的搜索索引
+type searchIndex struct {
+	mn     sync.RWMutex
+	index  *fulltext.Index
+	docs   []ArchivedMessage
+	texts  []string
+	msgIds map[string]int // MsgId到docs中的位置
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		index:  fulltext.NewIndex(),
+		msgIds: map[string]int{},
+	}
+}
+
+func (search *searchIndex) add(msg ArchivedMessage) {
+	search.mn.Lock()
+	defer search.mn.Unlock()
+
+	text := searchText(msg.Message)
+	// 原始消息只在索引中占用内存, 不需要保留
+	msg.Message.OriginalMsg = nil
+
+	if i, found := search.msgIds[msg.MsgId]; found && len(msg.MsgId) > 0 {
+		// 同步回显替换临时记录, 内容相同不需要重新索引
+		if search.docs[i].Provisional && !msg.Provisional {
+			search.docs[i] = msg
+		}
+		return
+	}
+	if len(msg.MsgId) > 0 {
+		search.msgIds[msg.MsgId] = len(search.docs)
+	}
+
+	search.index.Add(text)
+	search.docs = append(search.docs, msg)
+	search.texts = append(search.texts, text)
+}
+
+// 建立索引的文本: 消息内容, 链接标题和文件名
+func searchText(data MessageEventData) string {
+	if !isAppMsg(data) {
+		return plainContent(data)
+	}
+
+	texts := []string{}
+	content := html.UnescapeString(data.Content)
+	if match := appTitleReg.FindStringSubmatch(content); len(match) == 2 {
+		texts = append(texts, match[1])
+	}
+	if fileName, ok := data.OriginalMsg["FileName"].(string); ok && len(fileName) > 0 && (len(texts) == 0 || texts[0] != fileName) {
+		texts = append(texts, fileName)
+	}
+	if len(texts) == 0 {
+		return content
+	}
+	return strings.Join(texts, "\n")
+}
+
+// 从存档建立索引
+func (wx *WxChat) buildSearchIndex(store ArchiveStore) *searchIndex {
+	search := newSearchIndex()
+	query := ArchiveQuery{Limit: 500}
+	for {
+		page, err := store.Query(query)
+		if err != nil {
+			wx.log(moduleMessage).Warnw("Build Search Index Failed.", "err", err)
+			break
+		}
+		for _, msg := range page.Messages {
+			search.add(msg)
+		}
+		if len(page.NextCursor) == 0 {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	wx.log(moduleMessage).Infow("Search Index Built.", "count", len(search.docs))
+	return search
+}
+
+// 搜索存档的消息, 需先通过SetArchive设置存档
+func (wx *WxChat) Search(query SearchQuery) []Hit {
+	_, search := wx.currentArchive()
+	hits := []Hit{}
+	if search == nil {
+		return hits
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	search.mn.RLock()
+	defer search.mn.RUnlock()
+
+	var matches []fulltext.Match
+	if len(strings.TrimSpace(query.Text)) > 0 {
+		matches = search.index.Search(query.Text)
+	} else {
+		// 没有关键词时按时间倒序列出
+		for i := len(search.docs) - 1; i >= 0; i-- {
+			matches = append(matches, fulltext.Match{Doc: i})
+		}
+	}
+
+	for _, match := range matches {
+		if len(hits) >= limit {
+			break
+		}
+		msg := search.docs[match.Doc]
+		if !query.matchMessage(msg) {
+			continue
+		}
+
+		hits = append(hits, Hit{
+			Message:   msg,
+			Score:     match.Score,
+			Highlight: fulltext.Highlight(search.texts[match.Doc], query.Text, HighlightPre, HighlightPost, highlightMaxRunes),
+		})
+	}
+
+	return hits
+}
+
+func (query SearchQuery) matchMessage(msg ArchivedMessage) bool {
+	if query.Since > 0 && msg.Time() < query.Since {
+		return false
+	}
+	if query.Until > 0 && msg.Time() >= query.Until {
+		return false
+	}
+
+	data := msg.Message
+	for _, exclude := range query.Exclude {
+		if exclude == msg.ConversationKey || exclude == data.FromUserName || exclude == data.ToUserName {
+			return false
+		}
+	}
+
+	if len(query.Sender) > 0 && query.Sender != msg.SenderStableId &&
+		!strings.Contains(data.SenderUserInfo.NickName, query.Sender) &&
+		!strings.Contains(data.SenderUserInfo.RemarkName, query.Sender) {
+		return false
+	}
+
+	if len(query.Group) > 0 {
+		if !data.IsGroupMessage {
+			return false
+		}
+		group := data.FromUserInfo
+		if strings.HasPrefix(data.ToUserName, "@@") {
+			group = data.ToUserInfo
+		}
+		if query.Group != msg.ConversationKey && !strings.Contains(group.NickName, query.Group) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 解析搜索语句, 如"周报 from:张三 group:项目群 since:2024-01-01 until:2024-02-01 limit:10"
+// 日期按本地时区, until当天不包含在内
+func ParseSearchQuery(s string) (SearchQuery, error) {
+	query := SearchQuery{}
+	words := []string{}
+
+	for _, field := range strings.Fields(s) {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 || len(parts[1]) == 0 {
+			words = append(words, field)
+			continue
+		}
+
+		switch strings.ToLower(parts[0]) {
+		case "from":
+			query.Sender = parts[1]
+		case "group":
+			query.Group = parts[1]
+		case "since", "until":
+			t, err := time.ParseInLocation("2006-01-02", parts[1], time.Local)
+			if err != nil {
+				return query, err
+			}
+			if strings.ToLower(parts[0]) == "since" {
+				query.Since = t.Unix()
+			} else {
+				query.Until = t.Unix()
+			}
+		case "limit":
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return query, err
+			}
+			query.Limit = n
+		default:
+			words = append(words, field)
+		}
+	}
+
+	query.Text = strings.Join(words, " ")
+	return query, nil
+}
@@ -0,0 +1,470 @@
+package wxchat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"wxchat/utils"
+)
+
+// 发送优先级
+type SendPriority int
+
+const (
+	PRIORITY_LOW SendPriority = iota
+	PRIORITY_NORMAL
+	PRIORITY_HIGH
+)
+
+// 待发送消息类型
+type OutgoingType int
+
+const (
+	_                 OutgoingType = iota
+	OUTGOING_TEXT                  // 文本
+	OUTGOING_IMG                   // 图片
+	OUTGOING_APP                   // 文件
+	OUTGOING_EMOTICON              // 表情
+)
+
+// 待发送消息
+type OutgoingMsg struct {
+	Id         string
+	Type       OutgoingType
+	To         string
+	Content    string
+	MediaId    string
+	FileName   string
+	FileSize   int64
+	Ext        string
+	Priority   SendPriority
+	Retry      int
+	CreateTime int64
+
+	seq       uint64
+	notBefore time.Time
+	ticket    *SendTicket
+}
+
+// 发送队列配置
+type SendQueueConfig struct {
+	GlobalRate   float64       // 全局每秒发送条数
+	GlobalBurst  int           // 全局突发条数
+	UserRate     float64       // 单个接收人每秒发送条数
+	UserBurst    int           // 单个接收人突发条数
+	MinJitter    time.Duration // 每次发送前的最小随机等待
+	MaxJitter    time.Duration // 每次发送前的最大随机等待
+	MaxRetry     int           // 发送失败最大重试次数
+	RetryBackoff time.Duration // 重试等待时间, 每次重试翻倍
+	StorePath    string        // 未发送消息的持久化文件, 为空时不持久化
+}
+
+// 默认发送队列配置
+var DefaultSendQueueConfig = SendQueueConfig{
+	GlobalRate:   0.5,
+	GlobalBurst:  3,
+	UserRate:     0.2,
+	UserBurst:    2,
+	MinJitter:    time.Millisecond * 500,
+	MaxJitter:    time.Second * 2,
+	MaxRetry:     3,
+	RetryBackoff: time.Second * 5,
+}
+
+var ErrSendCanceled = errors.New("Send Canceled")
+
+var ErrSendQueueNotRunning = errors.New("Send Queue Not Running")
+
+// 发送凭据, 用于等待消息发送结果
+type SendTicket struct {
+	done     chan struct{}
+	err      error
+	canceled bool // 已撤回, 正在发送的消息失败后不再重试
+}
+
+// 等待消息发送完成
+func (ticket *SendTicket) Wait(ctx context.Context) error {
+	select {
+	case <-ticket.done:
+		return ticket.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 消息发送完成时关闭
+func (ticket *SendTicket) Done() <-chan struct{} {
+	return ticket.done
+}
+
+// 发送结果, 未完成时为nil
+func (ticket *SendTicket) Err() error {
+	select {
+	case <-ticket.done:
+		return ticket.err
+	default:
+		return nil
+	}
+}
+
+// 令牌桶
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// 获取一个令牌, 令牌不足时返回需要等待的时间
+func (bucket *tokenBucket) take(now time.Time) time.Duration {
+	if bucket.rate <= 0 {
+		return 0
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+}
+
+// 发送队列
+type sendQueue struct {
+	mn      sync.Mutex
+	wx      *WxChat
+	config  SendQueueConfig
+	items   []*OutgoingMsg
+	seq     uint64
+	global  *tokenBucket
+	users   map[string]*tokenBucket
+	wakeup  chan struct{}
+	running bool
+}
+
+func newSendQueue(wx *WxChat, config SendQueueConfig) *sendQueue {
+	return &sendQueue{
+		wx:     wx,
+		config: config,
+		global: newTokenBucket(config.GlobalRate, config.GlobalBurst),
+		users:  map[string]*tokenBucket{},
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// 设置发送队列配置, 需在Login之前调用
+func (wx *WxChat) SetSendQueueConfig(config SendQueueConfig) {
+	wx.sendQueue.mn.Lock()
+	defer wx.sendQueue.mn.Unlock()
+	wx.sendQueue.config = config
+	wx.sendQueue.global = newTokenBucket(config.GlobalRate, config.GlobalBurst)
+	wx.sendQueue.users = map[string]*tokenBucket{}
+}
+
+// 消息加入发送队列, 可通过返回的SendTicket等待发送结果, 也可直接忽略.
+// 发送协程在Login成功后启动, 之前加入的消息会等到登录后发送
+func (wx *WxChat) Enqueue(msg OutgoingMsg) *SendTicket {
+	return wx.sendQueue.push(&msg)
+}
+
+// 文本消息加入发送队列
+func (wx *WxChat) QueueTextMsg(content string, to string, priority SendPriority) *SendTicket {
+	return wx.Enqueue(OutgoingMsg{
+		Type:     OUTGOING_TEXT,
+		To:       to,
+		Content:  content,
+		Priority: priority,
+	})
+}
+
+// 图片消息加入发送队列
+func (wx *WxChat) QueueImgMsg(to string, mediaId string, priority SendPriority) *SendTicket {
+	return wx.Enqueue(OutgoingMsg{
+		Type:     OUTGOING_IMG,
+		To:       to,
+		MediaId:  mediaId,
+		Priority: priority,
+	})
+}
+
+// 文件消息加入发送队列
+func (wx *WxChat) QueueAppMsg(to string, mediaId string, filename string, fileSize int64, ext string, priority SendPriority) *SendTicket {
+	return wx.Enqueue(OutgoingMsg{
+		Type:     OUTGOING_APP,
+		To:       to,
+		MediaId:  mediaId,
+		FileName: filename,
+		FileSize: fileSize,
+		Ext:      ext,
+		Priority: priority,
+	})
+}
+
+// 待发送消息数量
+func (wx *WxChat) PendingMsgCount() int {
+	wx.sendQueue.mn.Lock()
+	defer wx.sendQueue.mn.Unlock()
+	return len(wx.sendQueue.items)
+}
+
+func (queue *sendQueue) push(msg *OutgoingMsg) *SendTicket {
+	ticket := &SendTicket{done: make(chan struct{})}
+
+	queue.mn.Lock()
+	if msg.Id == "" {
+		msg.Id = utils.GetUnixMsTime() + strconv.Itoa(rand.Intn(10000))
+	}
+	if msg.CreateTime == 0 {
+		msg.CreateTime = time.Now().Unix()
+	}
+	queue.seq++
+	msg.seq = queue.seq
+	msg.ticket = ticket
+	queue.items = append(queue.items, msg)
+	queue.save()
+	queue.mn.Unlock()
+
+	queue.notify()
+	return ticket
+}
+
+// 发送协程是否已启动
+func (queue *sendQueue) isRunning() bool {
+	queue.mn.Lock()
+	defer queue.mn.Unlock()
+	return queue.running
+}
+
+func (queue *sendQueue) notify() {
+	select {
+	case queue.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// 启动发送协程, 并恢复上次未发送的消息
+func (queue *sendQueue) start() {
+	queue.mn.Lock()
+	if queue.running {
+		queue.mn.Unlock()
+		return
+	}
+	queue.running = true
+	queue.load()
+	queue.mn.Unlock()
+
+	go queue.loop()
+}
+
+func (queue *sendQueue) loop() {
+	for {
+		msg, wait := queue.next()
+		if msg == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-queue.wakeup:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		queue.mn.Lock()
+		minJitter, maxJitter := queue.config.MinJitter, queue.config.MaxJitter
+		queue.mn.Unlock()
+		jitter := minJitter
+		if maxJitter > minJitter {
+			jitter += time.Duration(rand.Int63n(int64(maxJitter - minJitter)))
+		}
+		time.Sleep(jitter)
+
+		queue.finish(msg, queue.wx.sendOutgoing(msg))
+	}
+}
+
+// 取出优先级最高且可以发送的消息, 没有时返回需要等待的时间
+func (queue *sendQueue) next() (*OutgoingMsg, time.Duration) {
+	queue.mn.Lock()
+	defer queue.mn.Unlock()
+
+	now := time.Now()
+	wait := time.Minute
+	for {
+		index := -1
+		for i, item := range queue.items {
+			if item.notBefore.After(now) {
+				if d := item.notBefore.Sub(now); d < wait {
+					wait = d
+				}
+				continue
+			}
+			if index == -1 || item.Priority > queue.items[index].Priority ||
+				(item.Priority == queue.items[index].Priority && item.seq < queue.items[index].seq) {
+				index = i
+			}
+		}
+
+		if index == -1 {
+			return nil, wait
+		}
+
+		msg := queue.items[index]
+		bucket, found := queue.users[msg.To]
+		if !found {
+			bucket = newTokenBucket(queue.config.UserRate, queue.config.UserBurst)
+			queue.users[msg.To] = bucket
+		}
+		if d := bucket.take(now); d > 0 {
+			msg.notBefore = now.Add(d)
+			continue
+		}
+
+		if d := queue.global.take(now); d > 0 {
+			// 令牌已被接收人桶消耗, 归还后等待全局令牌
+			bucket.tokens++
+			return nil, d
+		}
+
+		queue.items = append(queue.items[:index], queue.items[index+1:]...)
+		return msg, 0
+	}
+}
+
+// 处理发送结果, 失败时按退避时间重新入队
+func (queue *sendQueue) finish(msg *OutgoingMsg, err error) {
+	queue.mn.Lock()
+	defer queue.mn.Unlock()
+
+	canceled := msg.ticket != nil && msg.ticket.canceled
+	if err != nil && msg.Retry < queue.config.MaxRetry && !canceled {
+		msg.notBefore = time.Now().Add(queue.config.RetryBackoff * time.Duration(1<<uint(msg.Retry)))
+		msg.Retry++
+		queue.items = append(queue.items, msg)
+		queue.save()
+		queue.wx.log(moduleMessage).Warnw("Send Queue Retry.", "id", msg.Id, "to", msg.To, "retry", msg.Retry, "err", err)
+		return
+	}
+
+	queue.save()
+	if err != nil {
+		queue.wx.log(moduleMessage).Errorw("Send Queue Failed.", "id", msg.Id, "to", msg.To, "err", err)
+	}
+	if msg.ticket != nil {
+		msg.ticket.err = err
+		close(msg.ticket.done)
+	}
+}
+
+// 从队列中撤回未发送的消息
+func (queue *sendQueue) cancel(tickets []*SendTicket) {
+	queue.mn.Lock()
+	defer queue.mn.Unlock()
+
+	canceled := map[*SendTicket]bool{}
+	for _, ticket := range tickets {
+		if ticket != nil {
+			canceled[ticket] = true
+			ticket.canceled = true
+		}
+	}
+
+	items := queue.items[:0]
+	for _, item := range queue.items {
+		if canceled[item.ticket] {
+			item.ticket.err = ErrSendCanceled
+			close(item.ticket.done)
+			continue
+		}
+		items = append(items, item)
+	}
+	queue.items = items
+	queue.save()
+}
+
+// 持久化未发送的消息
+func (queue *sendQueue) save() {
+	if queue.config.StorePath == "" {
+		return
+	}
+
+	bs, err := json.Marshal(queue.items)
+	if err == nil {
+		err = ioutil.WriteFile(queue.config.StorePath, bs, 0600)
+	}
+	if err != nil {
+		queue.wx.log(moduleMessage).Errorw("Send Queue Save Failed.", "err", err)
+	}
+}
+
+// 读取上次未发送的消息
+func (queue *sendQueue) load() {
+	if queue.config.StorePath == "" {
+		return
+	}
+
+	bs, err := ioutil.ReadFile(queue.config.StorePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			queue.wx.log(moduleMessage).Errorw("Send Queue Load Failed.", "err", err)
+		}
+		return
+	}
+
+	var items []*OutgoingMsg
+	err = json.Unmarshal(bs, &items)
+	if err != nil {
+		queue.wx.log(moduleMessage).Errorw("Send Queue Load Failed.", "err", err)
+		return
+	}
+
+	for _, item := range items {
+		item.ticket = &SendTicket{done: make(chan struct{})}
+	}
+	queue.items = append(items, queue.items...)
+
+	queue.seq = 0
+	for _, item := range queue.items {
+		queue.seq++
+		item.seq = queue.seq
+	}
+}
+
+// 根据消息类型发送
+func (wx *WxChat) sendOutgoing(msg *OutgoingMsg) error {
+	switch msg.Type {
+	case OUTGOING_TEXT:
+		_, err := wx.SendTextMsg(msg.Content, msg.To)
+		return err
+	case OUTGOING_IMG:
+		return wx.SendImgMsg(msg.To, msg.MediaId)
+	case OUTGOING_APP:
+		return wx.SendAppMsg(msg.To, msg.MediaId, msg.FileName, msg.FileSize, msg.Ext)
+	case OUTGOING_EMOTICON:
+		return wx.SendEmoticon(msg.To, msg.MediaId)
+	}
+	return errors.New("Unknown Outgoing Type")
+}
@@ -0,0 +1,193 @@
+package wxchat
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	logs "wxchat/log"
+)
+
+func TestBroadcastBeforeLogin(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.contacts.Put(&Contact{UserName: "@a", NickName: "a", Type: Friend})
+
+	if _, err := wx.Broadcast(context.Background(), nil, "hi", false); err != ErrSendQueueNotRunning {
+		t.Fatalf("got %v, want ErrSendQueueNotRunning", err)
+	}
+
+	report, err := wx.Broadcast(context.Background(), nil, "hi", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 1 {
+		t.Fatalf("dry run: got %d results, want 1", len(report.Results))
+	}
+}
+
+func TestSendQueueCancel(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.SetSendQueueConfig(SendQueueConfig{MaxRetry: 3})
+	queue := wx.sendQueue
+
+	inFlight := wx.QueueTextMsg("a", "@a", PRIORITY_HIGH)
+	queued := wx.QueueTextMsg("b", "@b", PRIORITY_LOW)
+
+	// 模拟发送协程取出第一条消息
+	msg, _ := queue.next()
+	if msg == nil || msg.ticket != inFlight {
+		t.Fatal("want the high priority message first")
+	}
+
+	queue.cancel([]*SendTicket{inFlight, queued})
+	if err := queued.Err(); err != ErrSendCanceled {
+		t.Fatalf("queued: got %v, want ErrSendCanceled", err)
+	}
+
+	// 撤回后正在发送的消息失败时不再重试, 结果为实际的错误
+	sendErr := errors.New("send failed")
+	queue.finish(msg, sendErr)
+	if err := inFlight.Err(); err != sendErr {
+		t.Fatalf("in flight: got %v, want %v", err, sendErr)
+	}
+	if wx.PendingMsgCount() != 0 {
+		t.Fatalf("got %d pending messages, want 0", wx.PendingMsgCount())
+	}
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(2, 2)
+	bucket.last = start
+
+	tests := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{0, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+		{250 * time.Millisecond, 250 * time.Millisecond},
+		{500 * time.Millisecond, 0},
+		{10 * time.Second, 0},
+		{10 * time.Second, 0},
+		{10 * time.Second, 500 * time.Millisecond},
+	}
+
+	for i, tt := range tests {
+		if got := bucket.take(start.Add(tt.at)); got != tt.want {
+			t.Errorf("take #%d at %v: got %v, want %v", i, tt.at, got, tt.want)
+		}
+	}
+
+	unlimited := newTokenBucket(0, 0)
+	for i := 0; i < 10; i++ {
+		if got := unlimited.take(start); got != 0 {
+			t.Fatalf("rate 0: got %v, want 0", got)
+		}
+	}
+}
+
+func TestSendQueuePriority(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.SetSendQueueConfig(SendQueueConfig{})
+	queue := wx.sendQueue
+
+	wx.QueueTextMsg("low 1", "@a", PRIORITY_LOW)
+	wx.QueueTextMsg("normal", "@b", PRIORITY_NORMAL)
+	wx.QueueTextMsg("high", "@c", PRIORITY_HIGH)
+	wx.QueueTextMsg("low 2", "@d", PRIORITY_LOW)
+
+	for _, want := range []string{"high", "normal", "low 1", "low 2"} {
+		msg, _ := queue.next()
+		if msg == nil || msg.Content != want {
+			t.Fatalf("got %+v, want %q", msg, want)
+		}
+	}
+	if msg, _ := queue.next(); msg != nil {
+		t.Fatalf("got %+v, want empty queue", msg)
+	}
+}
+
+func TestSendQueueRetry(t *testing.T) {
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.SetSendQueueConfig(SendQueueConfig{MaxRetry: 2, RetryBackoff: time.Second})
+	queue := wx.sendQueue
+
+	ticket := wx.QueueTextMsg("hi", "@a", PRIORITY_NORMAL)
+	msg, _ := queue.next()
+	sendErr := errors.New("send failed")
+
+	// 每次重试等待时间翻倍
+	for retry, backoff := range []time.Duration{time.Second, 2 * time.Second} {
+		before := time.Now()
+		queue.finish(msg, sendErr)
+		if msg.Retry != retry+1 {
+			t.Fatalf("retry: got %d, want %d", msg.Retry, retry+1)
+		}
+		if wait := msg.notBefore.Sub(before); wait < backoff || wait > backoff+time.Second {
+			t.Fatalf("retry %d: got backoff %v, want %v", msg.Retry, wait, backoff)
+		}
+		if wx.PendingMsgCount() != 1 || ticket.Err() != nil {
+			t.Fatalf("retry %d: message should be queued again", msg.Retry)
+		}
+		if next, wait := queue.next(); next != nil || wait <= 0 {
+			t.Fatalf("retry %d: message should wait for backoff", msg.Retry)
+		}
+		queue.mn.Lock()
+		queue.items = queue.items[:0]
+		queue.mn.Unlock()
+	}
+
+	// 超过最大重试次数后结束
+	queue.finish(msg, sendErr)
+	if err := ticket.Err(); err != sendErr {
+		t.Fatalf("got %v, want %v", err, sendErr)
+	}
+	if wx.PendingMsgCount() != 0 {
+		t.Fatalf("got %d pending messages, want 0", wx.PendingMsgCount())
+	}
+}
+
+func TestSendQueueSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	config := SendQueueConfig{StorePath: filepath.Join(dir, "queue.json")}
+
+	wx := NewWxChat(filepath.Join(dir, "db.json"), logs.NewFanoutLogger())
+	wx.SetSendQueueConfig(config)
+	wx.QueueTextMsg("first", "@a", PRIORITY_LOW)
+	wx.QueueImgMsg("@b", "media", PRIORITY_HIGH)
+
+	info, err := os.Stat(config.StorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("file mode: got %v, want 0600", mode)
+	}
+
+	// 重新启动后恢复
+	restarted := NewWxChat(filepath.Join(dir, "db2.json"), logs.NewFanoutLogger())
+	restarted.SetSendQueueConfig(config)
+	queue := restarted.sendQueue
+	queue.mn.Lock()
+	queue.load()
+	queue.mn.Unlock()
+
+	if restarted.PendingMsgCount() != 2 {
+		t.Fatalf("got %d pending messages, want 2", restarted.PendingMsgCount())
+	}
+	msg, _ := queue.next()
+	if msg == nil || msg.Type != OUTGOING_IMG || msg.To != "@b" || msg.MediaId != "media" || msg.Priority != PRIORITY_HIGH {
+		t.Fatalf("got %+v, want the image message", msg)
+	}
+	if msg.ticket == nil {
+		t.Fatal("loaded message should have a ticket")
+	}
+	msg, _ = queue.next()
+	if msg == nil || msg.Type != OUTGOING_TEXT || msg.Content != "first" {
+		t.Fatalf("got %+v, want the text message", msg)
+	}
+}
@@ -0,0 +1,340 @@
+package wxchat
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 聊天记录导出格式
+type TranscriptFormat int
+
+const (
+	TRANSCRIPT_HTML     TranscriptFormat = iota // 独立的HTML文件, 图片和头像内嵌
+	TRANSCRIPT_MARKDOWN                         // Markdown
+	TRANSCRIPT_TEXT                             // 纯文本
+)
+
+// 聊天记录导出选项
+type TranscriptOptions struct {
+	Format  TranscriptFormat
+	Title   string // 为空时为会话名称
+	Since   int64  // CreateTime >= Since, 0不限
+	Until   int64  // CreateTime < Until, 0不限
+	Images  bool   // 下载图片并以data uri内嵌, 只能下载本次登录收到的图片
+	Avatars bool   // 内嵌发送人头像, 只对HTML有效
+}
+
+var ErrNoArchive = errors.New("未设置消息存档")
+
+// 导出的一条消息
+type transcriptMessage struct {
+	Time     string
+	Sender   string
+	Avatar   template.URL
+	Text     string
+	Image    template.URL
+	IsMySelf bool
+	Revoked  bool // 已被撤回
+	IsNotice bool // 撤回等系统通知
+}
+
+// 导出会话的聊天记录, conversationKey为群或联系人的稳定ID
+func (wx *WxChat) ExportTranscript(w io.Writer, conversationKey string, options TranscriptOptions) error {
+	archive, _ := wx.currentArchive()
+	if archive == nil {
+		return ErrNoArchive
+	}
+
+	archived := []ArchivedMessage{}
+	query := ArchiveQuery{
+		ConversationKey: conversationKey,
+		Since:           options.Since,
+		Until:           options.Until,
+		Limit:           500,
+	}
+	for {
+		page, err := archive.Query(query)
+		if err != nil {
+			return err
+		}
+		archived = append(archived, page.Messages...)
+		if len(page.NextCursor) == 0 {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	revoked := map[string]bool{}
+	for _, msg := range archived {
+		if len(msg.Message.RevokedMsgId) > 0 {
+			revoked[msg.Message.RevokedMsgId] = true
+		}
+	}
+
+	// 当前的群成员, 以稳定ID对应到存档的发送人
+	conversation, _ := wx.contacts.FindByStableId(conversationKey)
+	members := map[string]*Member{}
+	if Group == conversation.Type {
+		for _, member := range conversation.MemberList {
+			members[wx.memberStableId(conversation.UserName, *member)] = member
+		}
+	}
+
+	title := options.Title
+	if len(title) == 0 {
+		title = contactName(conversation)
+	}
+	if len(title) == 0 {
+		title = conversationKey
+	}
+
+	avatars := map[string]template.URL{}
+	messages := []transcriptMessage{}
+	for _, msg := range archived {
+		data := msg.Message
+		item := transcriptMessage{
+			Time:     time.Unix(msg.Time(), 0).Format("2006-01-02 15:04:05"),
+			Sender:   wx.transcriptSender(msg, conversation, members),
+			Text:     transcriptText(data),
+			IsMySelf: data.IsSendByMySelf,
+			Revoked:  revoked[msg.MsgId],
+			IsNotice: len(data.RevokedMsgId) > 0,
+		}
+
+		if options.Images && data.MessageType == ImgMessage && len(msg.MsgId) > 0 {
+			if bs, err := wx.downloadMsgImg(msg.MsgId); err == nil {
+				item.Image = dataUri(bs)
+			}
+		}
+
+		if options.Avatars && options.Format == TRANSCRIPT_HTML && !item.IsNotice {
+			avatar, found := avatars[msg.SenderStableId]
+			if !found {
+				avatar = wx.transcriptAvatar(msg, conversation, members)
+				avatars[msg.SenderStableId] = avatar
+			}
+			item.Avatar = avatar
+		}
+
+		messages = append(messages, item)
+	}
+
+	switch options.Format {
+	case TRANSCRIPT_HTML:
+		return transcriptTemplate.Execute(w, map[string]interface{}{
+			"Title":    title,
+			"Messages": messages,
+		})
+	case TRANSCRIPT_MARKDOWN:
+		return writeTranscriptMarkdown(w, title, messages)
+	case TRANSCRIPT_TEXT:
+		return writeTranscriptText(w, title, messages)
+	}
+	return fmt.Errorf("unknown transcript format: %d", options.Format)
+}
+
+// 发送人名称: 群消息优先使用当前的群昵称, 私聊优先使用备注名
+func (wx *WxChat) transcriptSender(msg ArchivedMessage, conversation Contact, members map[string]*Member) string {
+	data := msg.Message
+	if len(data.RevokedMsgId) > 0 {
+		return ""
+	}
+	if data.IsSendByMySelf {
+		return wx.me.NickName
+	}
+
+	if member, found := members[msg.SenderStableId]; found {
+		if len(member.DisplayName) > 0 {
+			return member.DisplayName
+		}
+		return member.NickName
+	}
+	if contact, found := wx.contacts.FindByStableId(msg.SenderStableId); found && !data.IsGroupMessage {
+		return contactName(contact)
+	}
+
+	if len(data.SenderUserInfo.RemarkName) > 0 {
+		return data.SenderUserInfo.RemarkName
+	}
+	if len(data.SenderUserInfo.NickName) > 0 {
+		return data.SenderUserInfo.NickName
+	}
+	return contactName(data.FromUserInfo)
+}
+
+// 发送人头像, 获取失败时为空
+func (wx *WxChat) transcriptAvatar(msg ArchivedMessage, conversation Contact, members map[string]*Member) template.URL {
+	var bs []byte
+	var err error
+
+	switch {
+	case msg.Message.IsSendByMySelf:
+		bs, err = wx.GetAvatar(wx.me.UserName)
+	case members[msg.SenderStableId] != nil:
+		bs, err = wx.GetGroupMemberAvatar(conversation.UserName, members[msg.SenderStableId].UserName)
+	default:
+		contact, found := wx.contacts.FindByStableId(msg.SenderStableId)
+		if !found {
+			return ""
+		}
+		bs, err = wx.GetAvatar(contact.UserName)
+	}
+
+	if err != nil {
+		return ""
+	}
+	return dataUri(bs)
+}
+
+// 消息的文字描述
+func transcriptText(data MessageEventData) string {
+	if isAppMsg(data) {
+		return "[文件/链接] " + searchText(data)
+	}
+
+	switch data.MessageType {
+	case ImgMessage:
+		return "[图片]"
+	case VoiceMessage:
+		return "[语音]"
+	case VideoMessage:
+		return "[视频]"
+	case CardMessage:
+		return "[名片]"
+	case LocationMessage:
+		return "[位置] " + data.LocationInfo.Label
+	}
+	return plainContent(data)
+}
+
+// 下载消息中的图片
+func (wx *WxChat) downloadMsgImg(msgId string) ([]byte, error) {
+	msgImgApi := strings.Replace(wxChatApi["msgImgApi"], "{host}", wx.host, 1)
+	msgImgApi = strings.Replace(msgImgApi, "{msgid}", msgId, 1)
+	msgImgApi = strings.Replace(msgImgApi, "{skey}", wx.baseRequest.Skey, 1)
+
+	content, err := wx.httpClient.get(msgImgApi, time.Second*10, &httpHeader{
+		Accept:  "image/webp,image/*,*/*;q=0.8",
+		Host:    wx.host,
+		Referer: "https://" + wx.host + "/?&lang=zh_CN",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, errors.New("Msg Img Empty. [msgId]:" + msgId)
+	}
+	return []byte(content), nil
+}
+
+// 图片的data uri, 不是图片时(如会话失效返回的错误页面)为空
+func dataUri(bs []byte) template.URL {
+	contentType := http.DetectContentType(bs)
+	if !strings.HasPrefix(contentType, "image/") {
+		return ""
+	}
+	return template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(bs))
+}
+
+func writeTranscriptMarkdown(w io.Writer, title string, messages []transcriptMessage) error {
+	builder := strings.Builder{}
+	builder.WriteString("# " + markdownEscape(title) + "\n\n")
+
+	for _, msg := range messages {
+		if msg.IsNotice {
+			builder.WriteString("> _" + msg.Time + " " + markdownEscape(msg.Text) + "_\n\n")
+			continue
+		}
+
+		builder.WriteString("**" + markdownEscape(msg.Sender) + "** " + msg.Time)
+		if msg.Revoked {
+			builder.WriteString(" _(已撤回)_")
+		}
+		builder.WriteString("\n\n")
+
+		if len(msg.Image) > 0 {
+			builder.WriteString("![图片](" + string(msg.Image) + ")\n\n")
+			continue
+		}
+		for _, line := range strings.Split(msg.Text, "\n") {
+			builder.WriteString(markdownEscape(line) + "  \n")
+		}
+		builder.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;", "#", `\#`,
+)
+
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func writeTranscriptText(w io.Writer, title string, messages []transcriptMessage) error {
+	builder := strings.Builder{}
+	builder.WriteString(title + "\n\n")
+
+	for _, msg := range messages {
+		if msg.IsNotice {
+			builder.WriteString("[" + msg.Time + "] " + msg.Text + "\n")
+			continue
+		}
+
+		revoked := ""
+		if msg.Revoked {
+			revoked = " (已撤回)"
+		}
+		text := strings.Replace(msg.Text, "\n", "\n    ", -1)
+		builder.WriteString("[" + msg.Time + "] " + msg.Sender + revoked + ": " + text + "\n")
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; background: #f5f5f5; margin: 0; padding: 20px; }
+h1 { font-size: 20px; text-align: center; }
+.msg { display: flex; margin: 12px 0; }
+.msg.me { flex-direction: row-reverse; }
+.avatar { width: 40px; height: 40px; border-radius: 4px; margin: 0 10px; background: #ddd; }
+.body { max-width: 70%; }
+.meta { font-size: 12px; color: #999; margin-bottom: 4px; }
+.me .meta { text-align: right; }
+.bubble { background: #fff; border-radius: 4px; padding: 8px 12px; white-space: pre-wrap; word-break: break-all; }
+.me .bubble { background: #9eea6a; }
+.bubble img { max-width: 100%; }
+.revoked .bubble { opacity: 0.5; text-decoration: line-through; }
+.revoked-mark { color: #e64340; }
+.notice { text-align: center; font-size: 12px; color: #999; margin: 12px 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Messages}}{{if .IsNotice}}<div class="notice">{{.Time}} {{.Text}}</div>
+{{else}}<div class="msg{{if .IsMySelf}} me{{end}}{{if .Revoked}} revoked{{end}}">
+{{if .Avatar}}<img class="avatar" src="{{.Avatar}}">{{else}}<div class="avatar"></div>{{end}}
+<div class="body">
+<div class="meta">{{.Sender}} {{.Time}}{{if .Revoked}} <span class="revoked-mark">已撤回</span>{{end}}</div>
+<div class="bubble">{{if .Image}}<img src="{{.Image}}">{{else}}{{.Text}}{{end}}</div>
+</div>
+</div>
+{{end}}{{end}}
+</body>
+</html>
+`))
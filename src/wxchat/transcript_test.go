@@ -0,0 +1,65 @@
+package wxchat
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	logs "wxchat/log"
+)
+
+func TestExportTranscriptMarksRevoked(t *testing.T) {
+	archive, err := OpenJSONLArchive(filepath.Join(t.TempDir(), "archive.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	wx := NewWxChat(filepath.Join(t.TempDir(), "db.json"), logs.NewFanoutLogger())
+	wx.me = Contact{UserName: "@me", NickName: "我"}
+	wx.SetArchive(archive)
+
+	for _, msg := range []ArchivedMessage{
+		{ConversationKey: "k", MsgId: "1", CreateTime: 100, Message: MessageEventData{MessageType: TextMessage, Content: "a<b>", SenderUserInfo: SenderUserInfo{NickName: "张三"}}},
+		{ConversationKey: "k", MsgId: "2", CreateTime: 101, Message: MessageEventData{MessageType: TextMessage, Content: "好的", IsSendByMySelf: true}},
+		{ConversationKey: "k", MsgId: "3", CreateTime: 102, Message: MessageEventData{MessageType: TextMessage, Content: "\"张三\" 撤回了一条消息", RawContent: "<sysmsg/>", RevokedMsgId: "1"}},
+	} {
+		if err := archive.Append(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		format TranscriptFormat
+		want   []string
+	}{
+		{TRANSCRIPT_TEXT, []string{"张三 (已撤回): a<b>", "我: 好的", "\"张三\" 撤回了一条消息"}},
+		{TRANSCRIPT_MARKDOWN, []string{"**张三**", "_(已撤回)_", "a&lt;b&gt;"}},
+		{TRANSCRIPT_HTML, []string{`class="msg revoked"`, "a&lt;b&gt;", `class="notice"`}},
+	}
+	for _, test := range tests {
+		buffer := new(bytes.Buffer)
+		err := wx.ExportTranscript(buffer, "k", TranscriptOptions{Format: test.format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(buffer.String(), want) {
+				t.Errorf("format %d: missing %q in\n%s", test.format, want, buffer.String())
+			}
+		}
+	}
+}
+
+func TestDataUriOnlyImages(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if got := string(dataUri(png)); !strings.HasPrefix(got, "data:image/png;base64,") {
+		t.Errorf("png: got %q", got)
+	}
+
+	for _, bs := range [][]byte{[]byte("<html><body>error</body></html>"), []byte("plain text"), {}} {
+		if got := dataUri(bs); got != "" {
+			t.Errorf("%q: got %q, want empty", bs, got)
+		}
+	}
+}
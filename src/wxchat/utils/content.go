@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// 如 <span class="emoji emoji1f600"></span>, 国旗等为多个码点 emoji1f1e81f1f3
+	emojiSpanReg = regexp.MustCompile(`<span class="emoji emoji([0-9a-fA-F]+)"></span>`)
+	// 如 <img class="qqemoji qqemoji0" text="[微笑]_web" src="..." />
+	qqEmojiReg = regexp.MustCompile(`<img class="(?:qq)?emoji[^"]*" text="([^"]*)"[^>]*/?>`)
+	brReg      = regexp.MustCompile(`<br\s*/?>`)
+)
+
+// 解码消息内容: 表情标签转为emoji, <br/>转为换行, 再反转义html实体
+func DecodeContent(raw string) string {
+	return html.UnescapeString(decodeMarkup(raw))
+}
+
+// 发送前的反向处理: 网页版发送的是纯文本, 由服务器负责转义
+// 只需把从原始内容复制来的表情标签和<br/>还原, [微笑]等表情代码原样发送
+func EncodeContent(text string) string {
+	text = strings.Replace(decodeMarkup(text), "\r\n", "\n", -1)
+	return strings.Replace(text, "\r", "\n", -1)
+}
+
+func decodeMarkup(s string) string {
+	s = emojiSpanReg.ReplaceAllStringFunc(s, func(span string) string {
+		runes := hexToRunes(emojiSpanReg.FindStringSubmatch(span)[1])
+		if len(runes) == 0 {
+			return span
+		}
+		return string(runes)
+	})
+	s = qqEmojiReg.ReplaceAllStringFunc(s, func(img string) string {
+		return strings.TrimSuffix(qqEmojiReg.FindStringSubmatch(img)[1], "_web")
+	})
+	return brReg.ReplaceAllString(s, "\n")
+}
+
+// 拆分连续的码点, 1f开头的为5位, 其余为4位
+func hexToRunes(hex string) []rune {
+	runes := []rune{}
+	hex = strings.ToLower(hex)
+	for len(hex) > 0 {
+		size := 4
+		if len(hex) >= 5 && strings.HasPrefix(hex, "1f") {
+			size = 5
+		}
+		if len(hex) < size {
+			return nil
+		}
+		code, err := strconv.ParseUint(hex[:size], 16, 32)
+		if err != nil {
+			return nil
+		}
+		runes = append(runes, rune(code))
+		hex = hex[size:]
+	}
+	return runes
+}
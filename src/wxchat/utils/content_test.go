@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHexToRunes(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want []rune
+	}{
+		{"", []rune{}},
+		{"1f600", []rune{0x1f600}},
+		{"1F600", []rune{0x1f600}},
+		{"263a", []rune{0x263a}},
+		{"1f1e81f1f3", []rune{0x1f1e8, 0x1f1f3}},
+		{"0031fe0f20e3", []rune{0x31, 0xfe0f, 0x20e3}},
+		{"1f6", nil},
+		{"zzzz", nil},
+	}
+
+	for _, tt := range tests {
+		if got := hexToRunes(tt.hex); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hexToRunes(%q) = %U, want %U", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"hello", "hello"},
+		{`hi<span class="emoji emoji1f600"></span>`, "hi\U0001f600"},
+		{`<span class="emoji emoji1f1e81f1f3"></span>`, "\U0001f1e8\U0001f1f3"},
+		{`<span class="emoji emojizz"></span>`, `<span class="emoji emojizz"></span>`},
+		{`<img class="qqemoji qqemoji0" text="[微笑]_web" src="/zh_CN/htmledition/v2/images/spacer.gif" />`, "[微笑]"},
+		{"a<br/>b<br>c", "a\nb\nc"},
+		{"&lt;b&gt; &amp; &quot;", `<b> & "`},
+	}
+
+	for _, tt := range tests {
+		if got := DecodeContent(tt.raw); got != tt.want {
+			t.Errorf("DecodeContent(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -55,6 +57,25 @@ func substr(str string, start, end int) string {
 	return string(rs[start:end])
 }
 
+// 解析data uri, 如 data:img/jpg;base64,xxx
+func DecodeDataUri(uri string) ([]byte, error) {
+	if !strings.HasPrefix(uri, "data:") {
+		return nil, errors.New("不是data uri")
+	}
+	index := strings.Index(uri, ",")
+	if index == -1 {
+		return nil, errors.New("data uri格式错误")
+	}
+
+	meta, data := uri[len("data:"):index], uri[index+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+
+	s, err := url.PathUnescape(data)
+	return []byte(s), err
+}
+
 // 根据url获取host
 func GetHostByUrl(uri string) string {
 	u, err := url.Parse(uri)
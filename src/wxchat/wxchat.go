@@ -2,6 +2,7 @@ package wxchat
 
 import (
 	"fmt"
+	"sync"
 	logs "wxchat/log"
 )
 
@@ -13,25 +14,63 @@ type WxChat struct {
 	syncHost    string
 	host        string
 	me          Contact
-	contacts    map[string]*Contact
+	contacts    *ContactStore
 	httpClient  *httpClient
 	storage     *storage
-	logger      *logs.Logger
+	logger      logs.Interface
 	listeners   map[EventType]func(Event)
+	sendQueue   *sendQueue
+	avatars     *avatarCache
+	identities  *identityResolver
+	loggers     map[string]logs.Interface
+	archive     ArchiveStore
+	searchIndex *searchIndex
+	storeMn     sync.RWMutex // 保护avatars、archive和searchIndex, 运行中可以替换
+
+	friendAcceptor friendAcceptor
 }
 
+// 日志模块, 可以通过WXCHAT_LOG_LEVEL等分别设置级别
+const (
+	moduleLogin    = "login"
+	moduleListen   = "listen"
+	moduleContacts = "contacts"
+	moduleMessage  = "message"
+	moduleHttp     = "http"
+)
+
 // New A WxChat
-func NewWxChat(storageFilePath string, logger *logs.Logger) *WxChat {
+func NewWxChat(storageFilePath string, logger logs.Interface) *WxChat {
 	storage := storage{
 		filePath: storageFilePath,
 	}
 
-	return &WxChat{
+	wx := &WxChat{
+		contacts:   NewContactStore(),
 		httpClient: &httpClient{},
 		storage:    &storage,
 		listeners:  map[EventType]func(Event){},
 		logger:     logger,
+		loggers:    map[string]logs.Interface{},
+		avatars:    &avatarCache{index: map[string]avatarEntry{}},
+	}
+	wx.sendQueue = newSendQueue(wx, DefaultSendQueueConfig)
+	wx.identities = newIdentityResolver()
+	wx.contacts.resolver = wx.identities
+
+	for _, module := range []string{moduleLogin, moduleListen, moduleContacts, moduleMessage, moduleHttp} {
+		wx.loggers[module] = logs.WithModule(logger, module)
 	}
+
+	return wx
+}
+
+// 模块日志
+func (wx *WxChat) log(module string) logs.Interface {
+	if logger, found := wx.loggers[module]; found {
+		return logger
+	}
+	return wx.logger
 }
 
 // Login And Init
@@ -56,15 +95,18 @@ func (wx *WxChat) Login() error {
 	}
 
 	wx.triggerInitEvent(wx.me)
-	wx.logger.Info("WxChat Init.")
+	wx.log(moduleLogin).Infow("WxChat Init.")
+
+	// 登录后即可发送, 不必等到Run
+	wx.sendQueue.start()
 
-	err = wx.initContact()
+	report, err := wx.initContact()
 	if err != nil {
 		return err
 	}
 
-	wx.triggerContactsInitEvent(len(wx.contacts))
-	wx.logger.Info("Contacts Init.")
+	wx.triggerContactsInitEvent(wx.contacts.Len(), report)
+	wx.log(moduleContacts).Infow("Contacts Init.", "count", wx.contacts.Len())
 
 	return nil
 }
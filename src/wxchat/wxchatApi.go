@@ -14,5 +14,12 @@ var wxChatApi = map[string]string{
 	"uploadMediaApi":     "https://{prefix}.{host}/cgi-bin/mmwebwx-bin/webwxuploadmedia?f=json",
 	"sendAppMsgApi":      "https://{host}/cgi-bin/mmwebwx-bin/webwxsendappmsg?fun=async&f=json&pass_ticket={pass_ticket}",
 	"sendImgMsgApi":      "https://{host}/cgi-bin/mmwebwx-bin/webwxsendmsgimg?fun=async&f=json&pass_ticket={pass_ticket}",
+	"sendVideoMsgApi":    "https://{host}/cgi-bin/mmwebwx-bin/webwxsendvideomsg?fun=async&f=json&pass_ticket={pass_ticket}",
+	"sendEmoticonApi":    "https://{host}/cgi-bin/mmwebwx-bin/webwxsendemoticon?fun=sys&f=json&pass_ticket={pass_ticket}",
+	"createChatRoomApi":  "https://{host}/cgi-bin/mmwebwx-bin/webwxcreatechatroom?r={r}&lang=zh_CN&pass_ticket={pass_ticket}",
+	"updateChatRoomApi":  "https://{host}/cgi-bin/mmwebwx-bin/webwxupdatechatroom?fun={fun}&lang=zh_CN&pass_ticket={pass_ticket}",
+	"opLogApi":           "https://{host}/cgi-bin/mmwebwx-bin/webwxoplog?lang=zh_CN&pass_ticket={pass_ticket}",
+	"memberIconApi":      "https://{host}/cgi-bin/mmwebwx-bin/webwxgeticon?seq=0&username={username}&chatroomid={chatroomid}&skey={skey}",
+	"msgImgApi":          "https://{host}/cgi-bin/mmwebwx-bin/webwxgetmsgimg?MsgID={msgid}&skey={skey}",
 	"pushLoginApi":       "https://{host}/cgi-bin/mmwebwx-bin/webwxpushloginurl?uin={uin}",
 }